@@ -1,18 +1,55 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"github.com/isaeken/brickengine-go/modules"
 	"github.com/isaeken/brickengine-go/runtime"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: brick <file>")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "inspect":
+			inspect(os.Args[2:])
+			return
+		case "render":
+			render(os.Args[2:])
+			return
+		}
+	}
+
+	run(os.Args[1:])
+}
+
+func run(args []string) {
+	flags := flag.NewFlagSet("brick", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "fail on undefined variables and properties")
+	seed := flags.Int64("seed", 0, "run deterministically with this random seed and a fixed clock")
+	applyHTTP := httpFlags(flags)
+	applyExec := execFlags(flags)
+	applyEnv := envFlags(flags)
+	applyLog := logFlags(flags)
+	flags.Usage = func() {
+		fmt.Println("Usage: brick [-strict] [-seed n] [http flags] [exec flags] [env flags] [log flags] <file>")
+		fmt.Println("       brick inspect <template>")
+		fmt.Println("       brick render [-vars file.json] [-include patterns] [-dry-run] [-seed n] <src> <dst>")
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
 		os.Exit(1)
 	}
 
-	filePath := os.Args[1]
+	filePath := flags.Arg(0)
 	content, err := os.ReadFile(filePath)
 	if err != nil {
 		fmt.Printf("failed to read file %s: %v\n", filePath, err)
@@ -21,8 +58,30 @@ func main() {
 
 	ctx := runtime.Context{}
 	funcs := runtime.DefaultFunctions()
+	opts := runtime.Options{Strict: *strict, Deterministic: isFlagSet(flags, "seed"), Seed: *seed}
+	finish, err := applyHTTP(&opts)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	printPlan := applyExec(&opts)
+	if err := applyEnv(&opts); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if err := applyLog(&opts); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	opts.File = filePath
 
-	output, err := runtime.RunScript(string(content), ctx, funcs)
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	output, err := runtime.RunScriptContext(runCtx, string(content), ctx, funcs, opts)
+	if ferr := finish(); ferr != nil && err == nil {
+		err = ferr
+	}
+	printPlan()
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		os.Exit(1)
@@ -30,3 +89,257 @@ func main() {
 
 	fmt.Println(output)
 }
+
+// inspect prints the inputs declared in a template's front matter as JSON.
+func inspect(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: brick inspect <template>")
+		os.Exit(1)
+	}
+
+	filePath := args[0]
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		fmt.Printf("failed to read file %s: %v\n", filePath, err)
+		os.Exit(1)
+	}
+
+	inputs, err := runtime.InspectTemplate(string(content))
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if inputs == nil {
+		inputs = []runtime.TemplateInput{}
+	}
+
+	data, _ := json.MarshalIndent(inputs, "", "  ")
+	fmt.Println(string(data))
+}
+
+// render renders a directory tree of templates into a destination directory.
+func render(args []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	varsFile := flags.String("vars", "", "JSON file whose object is exposed as 'vars'")
+	include := flags.String("include", "", "comma-separated patterns of files to render; others are copied verbatim")
+	dryRun := flags.Bool("dry-run", false, "print a diff against the destination without writing")
+	strict := flags.Bool("strict", false, "fail on undefined variables and properties")
+	seed := flags.Int64("seed", 0, "render deterministically with this random seed and a fixed clock")
+	applyHTTP := httpFlags(flags)
+	applyExec := execFlags(flags)
+	applyEnv := envFlags(flags)
+	applyLog := logFlags(flags)
+	flags.Usage = func() {
+		fmt.Println("Usage: brick render [-vars file.json] [-include patterns] [-dry-run] [-strict] [-seed n] <src> <dst>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	ctx := runtime.Context{}
+	if *varsFile != "" {
+		content, err := os.ReadFile(*varsFile)
+		if err != nil {
+			fmt.Printf("failed to read file %s: %v\n", *varsFile, err)
+			os.Exit(1)
+		}
+		var vars map[string]interface{}
+		if err := json.Unmarshal(content, &vars); err != nil {
+			fmt.Printf("invalid vars file %s: %v\n", *varsFile, err)
+			os.Exit(1)
+		}
+		ctx["vars"] = vars
+	}
+
+	opts := runtime.RenderTreeOptions{
+		Functions: runtime.DefaultFunctions(),
+		Options:   runtime.Options{Strict: *strict, Deterministic: isFlagSet(flags, "seed"), Seed: *seed},
+		DryRun:    *dryRun,
+	}
+	if *include != "" {
+		opts.Patterns = strings.Split(*include, ",")
+	}
+	finish, err := applyHTTP(&opts.Options)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	printPlan := applyExec(&opts.Options)
+	if err := applyEnv(&opts.Options); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if err := applyLog(&opts.Options); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	src, dst := flags.Arg(0), flags.Arg(1)
+	files, err := runtime.RenderTree(os.DirFS(src), dst, ctx, opts)
+	if ferr := finish(); ferr != nil && err == nil {
+		err = ferr
+	}
+	printPlan()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	for _, file := range files {
+		fmt.Printf("%-9s %s\n", file.Action, file.Path)
+		if file.Diff != "" {
+			fmt.Print(file.Diff)
+		}
+	}
+}
+
+// httpFlags registers the flags configuring the http functions. The returned
+// function applies them to opts once the flags are parsed; its result saves
+// the recording, if any, after the run.
+func httpFlags(flags *flag.FlagSet) func(opts *runtime.Options) (func() error, error) {
+	allow := flags.String("http-allow", "", "comma-separated hosts (\"*.example.com\") and CIDRs scripts may reach")
+	blockPrivate := flags.Bool("http-block-private", false, "reject requests to loopback, private and link-local addresses")
+	maxRequests := flags.Int("http-max-requests", 0, "maximum number of http requests per run")
+	maxBytes := flags.Int64("http-max-bytes", 0, "maximum size of an http response body")
+	record := flags.String("http-record", "", "record http interactions to this JSON file")
+	replay := flags.String("http-replay", "", "answer http requests from this recording instead of the network")
+
+	return func(opts *runtime.Options) (func() error, error) {
+		policy := modules.HttpPolicy{
+			BlockPrivate:     *blockPrivate,
+			MaxRequests:      *maxRequests,
+			MaxResponseBytes: *maxBytes,
+		}
+		for _, entry := range strings.Split(*allow, ",") {
+			entry = strings.TrimSpace(entry)
+			switch {
+			case entry == "":
+			case strings.Contains(entry, "/") || net.ParseIP(entry) != nil:
+				policy.AllowedCIDRs = append(policy.AllowedCIDRs, entry)
+			default:
+				policy.AllowedHosts = append(policy.AllowedHosts, entry)
+			}
+		}
+		opts.HTTPPolicy = policy
+
+		if *replay != "" {
+			rec, err := modules.LoadHttpRecording(*replay)
+			if err != nil {
+				return nil, err
+			}
+			opts.HTTPTransport = modules.NewHttpReplayer(rec)
+		}
+		if *record != "" {
+			recorder := modules.NewHttpRecorder(opts.HTTPTransport)
+			opts.HTTPTransport = recorder
+			return func() error { return recorder.Save(*record) }, nil
+		}
+		return func() error { return nil }, nil
+	}
+}
+
+// execFlags registers the flags configuring exec.run. The returned function
+// applies them to opts once the flags are parsed; its result prints the
+// recorded commands after a dry run.
+func execFlags(flags *flag.FlagSet) func(opts *runtime.Options) func() {
+	allow := flags.String("exec-allow", "", "comma-separated commands scripts may run")
+	env := flags.String("exec-env", "", "comma-separated environment variables commands may be given")
+	dirs := flags.String("exec-dirs", "", "comma-separated directories commands may run in")
+	shell := flags.Bool("exec-shell", false, "allow exec.run with the shell option")
+	maxBytes := flags.Int("exec-max-bytes", 0, "maximum size of a command's stdout and stderr each")
+	dryRun := flags.Bool("exec-dry-run", false, "record commands instead of running them and print them after the run")
+
+	return func(opts *runtime.Options) func() {
+		opts.ExecPolicy = modules.ExecPolicy{
+			AllowedCommands: splitList(*allow),
+			AllowShell:      *shell,
+			AllowedEnv:      splitList(*env),
+			AllowedDirs:     splitList(*dirs),
+			MaxOutputBytes:  *maxBytes,
+		}
+
+		if !*dryRun {
+			opts.Executor = modules.OSExecutor{}
+			return func() {}
+		}
+		recorder := &modules.DryRunExecutor{}
+		opts.Executor = recorder
+		return func() {
+			for _, command := range recorder.Commands() {
+				fmt.Fprintf(os.Stderr, "would run: %s\n", command)
+			}
+		}
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// envFlags registers the flags configuring env() and secret().
+func envFlags(flags *flag.FlagSet) func(opts *runtime.Options) error {
+	allow := flags.String("env-allow", "", "comma-separated environment variables (\"APP_*\") scripts may read")
+	secrets := flags.String("secrets", "", "JSON file of secrets served by secret()")
+
+	return func(opts *runtime.Options) error {
+		opts.EnvAllow = splitList(*allow)
+		if *secrets == "" {
+			return nil
+		}
+		content, err := os.ReadFile(*secrets)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %w", *secrets, err)
+		}
+		var values modules.MapSecrets
+		if err := json.Unmarshal(content, &values); err != nil {
+			return fmt.Errorf("invalid secrets file %s: %w", *secrets, err)
+		}
+		opts.Secrets = values
+		return nil
+	}
+}
+
+// logFlags registers the flags configuring where log() and print() write.
+// Records go to stderr so they do not mix with the script's result.
+func logFlags(flags *flag.FlagSet) func(opts *runtime.Options) error {
+	level := flags.String("log-level", "info", "minimum level of log records: debug, info, warn or error")
+	format := flags.String("log-format", "text", "format of log records: text or json")
+
+	return func(opts *runtime.Options) error {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(*level)); err != nil {
+			return fmt.Errorf("invalid log level '%s'", *level)
+		}
+		handlerOpts := &slog.HandlerOptions{Level: l}
+		switch *format {
+		case "text":
+			opts.LogHandler = slog.NewTextHandler(os.Stderr, handlerOpts)
+		case "json":
+			opts.LogHandler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+		default:
+			return fmt.Errorf("invalid log format '%s'", *format)
+		}
+		return nil
+	}
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
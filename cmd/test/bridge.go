@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/isaeken/brickengine-go/runtime"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Location is embedded in Server to check that embedded fields are
+// flattened.
+type Location struct {
+	Region string `brick:"region"`
+	Zone   string `brick:"zone,omitempty"`
+}
+
+// Server is a typed host value passed to the scripts in examples/go.
+type Server struct {
+	Name     string            `brick:"name"`
+	Port     int               `brick:"port"`
+	Tags     []string          `brick:"tags"`
+	Labels   map[string]string `brick:"labels"`
+	Started  time.Time         `brick:"started"`
+	Uptime   time.Duration     `brick:"uptime"`
+	Weight   json.Number       `brick:"weight"`
+	Backup   *Server           `brick:"backup,omitempty"`
+	Password string            `brick:"-"`
+	Location
+}
+
+// Deployment is what examples/go/*decode*.bee scripts return, decoded with
+// runtime.Decode.
+type Deployment struct {
+	Host     string            `brick:"host"`
+	Replicas uint8             `brick:"replicas"`
+	Ports    []int             `brick:"ports"`
+	Env      map[string]string `brick:"env"`
+	Services map[int]string    `brick:"services"`
+	Timeout  time.Duration     `brick:"timeout"`
+	Deadline time.Time         `brick:"deadline"`
+	Address  net.IP            `brick:"address"`
+	Primary  *Server           `brick:"primary"`
+	Secret   string            `brick:"secret"`
+	Extra    interface{}       `brick:"extra"`
+}
+
+// Node is a tree whose children point back to their parent, passed to
+// examples/fails/go_cyclic_value.bee.
+type Node struct {
+	Name   string  `brick:"name"`
+	Parent *Node   `brick:"parent,omitempty"`
+	Kids   []*Node `brick:"kids"`
+}
+
+// addGoValues adds typed Go values and a bound Host to the context of files
+// in examples/go and of files starting with "go_" in examples/fails.
+func addGoValues(file string, ctx runtime.Context) {
+	file = filepath.ToSlash(file)
+	if !strings.HasPrefix(file, "examples/go/") && !strings.HasPrefix(file, "examples/fails/go_") {
+		return
+	}
+	backup := &Server{Name: "web-02", Port: 8081, Location: Location{Region: "eu-west-1"}}
+	ctx["server"] = &Server{
+		Name:     "web-01",
+		Port:     8080,
+		Tags:     []string{"nginx", "php"},
+		Labels:   map[string]string{"env": "production", "team": "web"},
+		Started:  fixedNow.Add(-36 * time.Hour),
+		Uptime:   90 * time.Minute,
+		Weight:   json.Number("0.75"),
+		Backup:   backup,
+		Password: "hunter2",
+		Location: Location{Region: "eu-central-1"},
+	}
+	ctx["plans"] = []string{"basic", "pro", "enterprise"}
+	ctx["limits"] = map[string]int{"cpu": 4, "memory_mb": 2048}
+	ctx["services"] = map[int]string{80: "http", 443: "https"}
+	ctx["gateway"] = net.ParseIP("10.0.0.1")
+	ctx["ports"] = [3]uint16{80, 443, 8080}
+	ctx["host"] = runtime.Bind(&Host{Name: "web-01"}, "Restart", "Status", "Restarts")
+
+	root := &Node{Name: "root"}
+	root.Kids = []*Node{{Name: "child", Parent: root}}
+	ctx["tree"] = root
+}
+
+// addGoFunctions adds go_types, a host function taking a Go map, for files in
+// examples/go.
+func addGoFunctions(file string, funcs runtime.Functions) {
+	if !strings.HasPrefix(filepath.ToSlash(file), "examples/go/") {
+		return
+	}
+	funcs["go_types"] = func(m map[string]interface{}) string {
+		return goTypes("", m)
+	}
+}
+
+// goTypes lists the Go type of every value in m, following nested maps, e.g.
+// "db: map[string]interface {}, db.port: float64".
+func goTypes(prefix string, m map[string]interface{}) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s%s: %T", prefix, k, m[k]))
+		if nested, ok := m[k].(map[string]interface{}); ok && len(nested) > 0 {
+			parts = append(parts, goTypes(prefix+k+".", nested))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runScript runs an example. Files containing "decode" are evaluated and
+// their result decoded into a Deployment, printed field by field. Files
+// containing "host_maps" also print the Go types of the "config" variable as
+// the host reads it back from the context. Files containing "sandbox" run
+// twice on one engine and context, reporting the second run, so it shows
+// anything the first run left behind.
+func runScript(file, code string, ctx runtime.Context, funcs runtime.Functions, opts runtime.Options) (string, error) {
+	name := filepath.Base(file)
+	if strings.Contains(name, "sandbox") {
+		engine := sandboxEngine()
+		if _, err := engine.RunScript(code, ctx, opts); err != nil {
+			return "", err
+		}
+		return engine.RunScript(code, ctx, opts)
+	}
+	if strings.Contains(name, "host_maps") {
+		out, err := runtime.RunScript(code, ctx, funcs, opts)
+		if err != nil {
+			return "", err
+		}
+		config, _ := ctx["config"].(map[string]interface{})
+		return fmt.Sprintf("%s\nhost reads config as %T: %s", out, ctx["config"], goTypes("", config)), nil
+	}
+	if !strings.Contains(name, "decode") {
+		return runtime.RunScript(code, ctx, funcs, opts)
+	}
+
+	val, err := runtime.EvalScript(code, ctx, funcs, opts)
+	if err != nil {
+		return "", err
+	}
+	var d Deployment
+	if err := runtime.Decode(val, &d); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "host: %s\n", d.Host)
+	fmt.Fprintf(&out, "replicas: %d\n", d.Replicas)
+	fmt.Fprintf(&out, "ports: %v\n", d.Ports)
+	fmt.Fprintf(&out, "env: %v\n", d.Env)
+	fmt.Fprintf(&out, "services: %v\n", d.Services)
+	fmt.Fprintf(&out, "timeout: %s\n", d.Timeout)
+	fmt.Fprintf(&out, "deadline: %s\n", d.Deadline.Format(time.RFC3339))
+	fmt.Fprintf(&out, "address: %s\n", d.Address)
+	fmt.Fprintf(&out, "primary: %s:%d in %s, tags %v\n", d.Primary.Name, d.Primary.Port, d.Primary.Region, d.Primary.Tags)
+	fmt.Fprintf(&out, "secret: %s\n", d.Secret)
+	fmt.Fprintf(&out, "extra: %#v", d.Extra)
+	return out.String(), nil
+}
+
+// Host is bound with runtime.Bind for examples/go, allowing Restart, Status
+// and Restarts but not Reboot.
+type Host struct {
+	Name     string `brick:"name"`
+	restarts []string
+}
+
+// ServiceStatus is returned by Host.Status.
+type ServiceStatus struct {
+	Service string    `brick:"service"`
+	Active  bool      `brick:"active"`
+	Checked time.Time `brick:"checked"`
+}
+
+func (h *Host) Restart(service string) (string, error) {
+	if service != "nginx" && service != "php-fpm" {
+		return "", fmt.Errorf("unknown service '%s'", service)
+	}
+	h.restarts = append(h.restarts, service)
+	return fmt.Sprintf("%s restarted on %s", service, h.Name), nil
+}
+
+func (h *Host) Status(ctx context.Context, service string) *ServiceStatus {
+	return &ServiceStatus{Service: service, Active: true, Checked: runtime.OptionsFrom(ctx).Now()}
+}
+
+func (h *Host) Restarts() []string {
+	return h.restarts
+}
+
+func (h *Host) Reboot() error {
+	return fmt.Errorf("rebooted %s", h.Name)
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/isaeken/brickengine-go/modules"
 	"github.com/isaeken/brickengine-go/runtime"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	rn "runtime"
 	"runtime/debug"
 	"strings"
@@ -19,8 +22,11 @@ const (
 )
 
 func main() {
-	scriptDirs := []string{"examples/basic", "examples/benchmarks", "examples/fails"}
-	templateDirs := []string{"examples/templates"}
+	server := newTestServer()
+	defer server.Close()
+
+	scriptDirs := []string{"examples/basic", "examples/network", "examples/http", "examples/fs", "examples/exec", "examples/go", "examples/benchmarks", "examples/fails"}
+	templateDirs := []string{"examples/templates", "examples/fails"}
 	total := 0
 	passed := 0
 
@@ -31,31 +37,42 @@ func main() {
 			fmt.Printf("🔍 %-40s ", file)
 
 			content, _ := os.ReadFile(file)
-			ctx := runtime.Context{}
-			funcs := runtime.DefaultFunctions()
+			ctx := runtime.Context{"base_url": server.URL}
+			addGoValues(file, ctx)
+			funcs := functionsFor(file)
+			opts, err := hostOptionsFor(file, optionsFor(file))
+			if err != nil {
+				fmt.Printf("%s❌ Failed: %v%s\n", red, err, reset)
+				continue
+			}
+			logs := captureLogs(file, &opts)
 
 			debug.FreeOSMemory()
 			var memStart, memEnd rn.MemStats
 			rn.ReadMemStats(&memStart)
 
 			start := time.Now()
-			result, err := runtime.RunScript(string(content), ctx, funcs)
+			result, err := runScript(file, string(content), ctx, funcs, opts)
 			duration := time.Since(start)
+			if logs != nil {
+				result = logs.String() + result
+			}
 
 			rn.ReadMemStats(&memEnd)
 			memUsage := memEnd.Alloc - memStart.Alloc
 
-			isFailTest := strings.Contains(file, "/fails/")
-			check := checkGolden(file, result)
-
-			if isFailTest {
-				if err != nil || check {
+			if strings.Contains(file, "/fails/") {
+				switch {
+				case err == nil:
+					fmt.Printf("%s❌ Unexpected Pass%s [%s, %.2f KB]\n", red, reset, formatDuration(duration), float64(memUsage)/1024)
+				case !checkError(file, err):
+					fmt.Printf("%s❌ Unexpected Error%s [%s, %.2f KB]\n", red, reset, formatDuration(duration), float64(memUsage)/1024)
+				default:
 					fmt.Printf("%s✅ Expected Fail%s [%s, %.2f KB]\n", green, reset, formatDuration(duration), float64(memUsage)/1024)
 					passed++
-				} else {
-					fmt.Printf("%s❌ Unexpected Pass%s [%s, %.2f KB]\n", red, reset, formatDuration(duration), float64(memUsage)/1024)
 				}
 			} else {
+				check := checkGolden(file, result)
 				if err != nil || !check {
 					fmt.Printf("%s❌ Failed: %v%s [%s, %.2f KB]\n", red, err, reset, formatDuration(duration), float64(memUsage)/1024)
 				} else {
@@ -75,19 +92,33 @@ func main() {
 			content, _ := os.ReadFile(file)
 			ctx := runtime.Context{}
 			funcs := runtime.DefaultFunctions()
+			opts := optionsFor(file)
 
 			debug.FreeOSMemory()
 			var memStart, memEnd rn.MemStats
 			rn.ReadMemStats(&memStart)
 
 			start := time.Now()
-			result, err := runtime.RunTemplate(string(content), ctx, funcs)
+			result, err := runTemplate(file, string(content), ctx, funcs, opts)
 			duration := time.Since(start)
 
 			rn.ReadMemStats(&memEnd)
 			memUsage := memEnd.Alloc - memStart.Alloc
-			check := checkGolden(file, result)
 
+			if strings.Contains(file, "/fails/") {
+				switch {
+				case err == nil:
+					fmt.Printf("%s❌ Unexpected Pass%s [%s, %.2f KB]\n", red, reset, formatDuration(duration), float64(memUsage)/1024)
+				case !checkError(file, err):
+					fmt.Printf("%s❌ Unexpected Error%s [%s, %.2f KB]\n", red, reset, formatDuration(duration), float64(memUsage)/1024)
+				default:
+					fmt.Printf("%s✅ Expected Fail%s [%s, %.2f KB]\n", green, reset, formatDuration(duration), float64(memUsage)/1024)
+					passed++
+				}
+				continue
+			}
+
+			check := checkGolden(file, result)
 			if err != nil || !check {
 				fmt.Printf("%s❌ Failed: %v%s [%s, %.2f KB]\n", red, err, reset, formatDuration(duration), float64(memUsage)/1024)
 			} else {
@@ -97,12 +128,188 @@ func main() {
 		}
 	}
 
+	trees, _ := filepath.Glob("examples/trees/*.json")
+	for _, file := range trees {
+		total++
+		fmt.Printf("🌳 %-40s ", file)
+
+		start := time.Now()
+		result, err := runTree(file)
+		duration := time.Since(start)
+		check := checkGolden(file, result)
+
+		if err != nil || !check {
+			fmt.Printf("%s❌ Failed: %v%s [%s]\n", red, err, reset, formatDuration(duration))
+		} else {
+			fmt.Printf("%s✅ Passed%s [%s]\n", green, reset, formatDuration(duration))
+			passed++
+		}
+	}
+
 	fmt.Printf("\n📊 Test Results: %d / %d passed\n", passed, total)
 	if passed != total {
+		server.Close()
 		os.Exit(1)
 	}
 }
 
+// fixedNow is the clock every example runs with. Together with a fixed seed
+// it makes timestamps, random values and UUIDs reproducible in golden files.
+var fixedNow = time.Date(2025, time.March, 14, 9, 26, 53, 0, time.UTC)
+
+// optionsFor derives run options from the example file name, e.g. files
+// containing "strict" run in strict-undefined mode, files containing
+// "delims" use "[[ ]]" template delimiters and files containing
+// "output_limit" may render at most 64 bytes.
+func optionsFor(file string) runtime.Options {
+	name := filepath.Base(file)
+	opts := runtime.Options{
+		Strict:        strings.Contains(name, "strict"),
+		Clock:         func() time.Time { return fixedNow },
+		Deterministic: true,
+		Seed:          1,
+	}
+	if strings.Contains(name, "step_limit") {
+		opts.MaxSteps = 10_000
+	}
+	if strings.Contains(name, "delims") {
+		opts.LeftDelim, opts.RightDelim = "[[", "]]"
+	}
+	if strings.Contains(name, "output_limit") {
+		opts.MaxOutputBytes = 64
+	}
+	return opts
+}
+
+// fsFor returns the file system for files containing "memfs", an in-memory
+// one with a template, and "dirfs", examples/fs/root opened read-only.
+func fsFor(file string) (modules.FileSystem, error) {
+	name := filepath.Base(file)
+	switch {
+	case strings.Contains(name, "memfs"):
+		return modules.NewMemFS(map[string]string{
+			"templates/site.conf.tpl": "server {\n    listen {{ port }};\n    server_name {{ host }};\n}\n",
+			"sites/old.conf":          "# stale\n",
+		}), nil
+	case strings.Contains(name, "dirfs"):
+		dir, err := modules.NewDirFS("examples/fs/root")
+		if err != nil {
+			return nil, err
+		}
+		return modules.ReadOnlyFS(dir), nil
+	}
+	return nil, nil
+}
+
+// functionsFor returns the default functions, or for files containing
+// "sandbox" those of sandboxEngine.
+func functionsFor(file string) runtime.Functions {
+	if strings.Contains(filepath.Base(file), "sandbox") {
+		return sandboxEngine().Functions()
+	}
+	funcs := runtime.DefaultFunctions()
+	addGoFunctions(file, funcs)
+	return funcs
+}
+
+// sandboxEngine returns the engine sandbox examples run on, granted only the
+// clock.
+func sandboxEngine() *runtime.Engine {
+	return runtime.NewEngine([]runtime.Capability{runtime.CapTime})
+}
+
+// hostOptionsFor applies the HTTP, file system, exec and environment options
+// the helpers below choose for the example file.
+func hostOptionsFor(file string, opts runtime.Options) (runtime.Options, error) {
+	var err error
+	opts.HTTPPolicy = httpPolicyFor(file)
+	if opts.HTTPTransport, err = httpTransportFor(file); err != nil {
+		return opts, err
+	}
+	if opts.FS, err = fsFor(file); err != nil {
+		return opts, err
+	}
+	opts.ExecPolicy, opts.Executor = execFor(file)
+	envFor(file, &opts)
+	return opts, nil
+}
+
+// httpPolicyFor returns the policy for files containing "policy": loopback
+// only, with small response and request limits.
+func httpPolicyFor(file string) modules.HttpPolicy {
+	if !strings.Contains(filepath.Base(file), "policy") {
+		return modules.HttpPolicy{}
+	}
+	return modules.HttpPolicy{
+		AllowedCIDRs:     []string{"127.0.0.0/8"},
+		BlockPrivate:     true,
+		MaxResponseBytes: 1024,
+		MaxRequests:      6,
+	}
+}
+
+// httpTransportFor replays the recording next to files containing "replay",
+// e.g. replay_api.json for replay_api.bee.
+func httpTransportFor(file string) (http.RoundTripper, error) {
+	if !strings.Contains(filepath.Base(file), "replay") {
+		return nil, nil
+	}
+	rec, err := modules.LoadHttpRecording(strings.TrimSuffix(file, filepath.Ext(file)) + ".json")
+	if err != nil {
+		return nil, err
+	}
+	return modules.NewHttpReplayer(rec), nil
+}
+
+// execFor lets files in examples/exec run a few commands in examples/exec,
+// only recording them for files containing "dry_run". Shell command lines are
+// allowed only for files containing "shell".
+func execFor(file string) (modules.ExecPolicy, modules.Executor) {
+	if !strings.HasPrefix(filepath.ToSlash(file), "examples/exec/") {
+		return modules.ExecPolicy{}, nil
+	}
+	name := filepath.Base(file)
+	policy := modules.ExecPolicy{
+		AllowedCommands: []string{"echo", "cat", "false", "sleep", "apt-get", "systemctl"},
+		AllowShell:      strings.Contains(name, "shell"),
+		AllowedEnv:      []string{"DEBIAN_FRONTEND", "GREETING"},
+		AllowedDirs:     []string{"examples/exec"},
+		MaxOutputBytes:  32,
+	}
+	if strings.Contains(name, "dry_run") {
+		return policy, &modules.DryRunExecutor{}
+	}
+	return policy, modules.OSExecutor{}
+}
+
+// envFor gives files containing "secrets" or "logging" a fixed environment
+// and secret store.
+func envFor(file string, opts *runtime.Options) {
+	name := filepath.Base(file)
+	if !strings.Contains(name, "secrets") && !strings.Contains(name, "logging") {
+		return
+	}
+	env := map[string]string{"APP_NAME": "shop", "APP_PORT": "8080", "DEPLOY_ENV": "staging", "HOME": "/root"}
+	opts.EnvAllow = []string{"APP_*", "DEPLOY_ENV", "DEPLOY_REGION"}
+	opts.LookupEnv = func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	opts.Secrets = modules.MapSecrets{"db/password": "s3cr3t!", "api/token": "tok_123"}
+}
+
+// captureLogs sends the log records of files containing "logging" to the
+// returned buffer, whose contents precede the result in the golden file.
+func captureLogs(file string, opts *runtime.Options) *bytes.Buffer {
+	if !strings.Contains(filepath.Base(file), "logging") {
+		return nil
+	}
+	logs := &bytes.Buffer{}
+	opts.LogHandler = slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})
+	opts.File = filepath.ToSlash(file)
+	return logs
+}
+
 func formatDuration(d time.Duration) string {
 	ms := d.Milliseconds()
 	if ms < 1 {
@@ -124,8 +331,8 @@ func checkGolden(file string, result interface{}) bool {
 		return true
 	}
 
-	actual := normalizeGoldenOutput(strings.Trim(resultStr, "\n"))
-	expected := normalizeGoldenOutput(strings.Trim(golden, "\n"))
+	actual := strings.Trim(resultStr, "\n")
+	expected := strings.Trim(golden, "\n")
 
 	if actual != expected {
 		fmt.Println("    ❌ Mismatch with golden output")
@@ -136,6 +343,19 @@ func checkGolden(file string, result interface{}) bool {
 	return true
 }
 
+// checkError compares the error of an example in examples/fails with its
+// golden file. Unlike checkGolden, a missing golden fails the example, as any
+// error, even a parse error, would pass it otherwise.
+func checkError(file string, err error) bool {
+	goldenPath := strings.TrimSuffix(file, filepath.Ext(file)) + ".golden"
+	if existing, _ := os.ReadFile(goldenPath); len(existing) == 0 {
+		fmt.Println("    ⚠️  No golden file found: " + goldenPath)
+		printIndentedOutput(err.Error())
+		return false
+	}
+	return checkGolden(file, err.Error())
+}
+
 func printIndentedOutput(output string) {
 	fmt.Println("    Output:")
 	for _, line := range strings.Split(output, "\n") {
@@ -160,13 +380,3 @@ func printDiff(expected, actual string) {
 	}
 	fmt.Println()
 }
-
-func normalizeGoldenOutput(output string) string {
-	reUUID := regexp.MustCompile(`[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}`)
-	reTime := regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z`)
-
-	output = reUUID.ReplaceAllString(output, "UUID")
-	output = reTime.ReplaceAllString(output, "NOW")
-
-	return output
-}
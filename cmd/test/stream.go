@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/isaeken/brickengine-go/runtime"
+	"path/filepath"
+	"strings"
+)
+
+// runTemplate renders a template example. Files containing "stream" are
+// parsed once and executed into a writer, listing every write it received.
+// Files containing "write_error" stream into a writer that fails on its
+// second write.
+func runTemplate(file, code string, ctx runtime.Context, funcs runtime.Functions, opts runtime.Options) (string, error) {
+	name := filepath.Base(file)
+	if !strings.Contains(name, "stream") {
+		return runtime.RunTemplate(code, ctx, funcs, opts)
+	}
+
+	tmpl, err := runtime.ParseTemplate(code, opts)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(name, "write_error") {
+		return "", tmpl.Execute(&failingWriter{accept: 1}, ctx, funcs)
+	}
+
+	w := &chunkWriter{}
+	if err := tmpl.Execute(w, ctx, funcs); err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for i, chunk := range w.chunks {
+		fmt.Fprintf(&out, "write %d: %q\n", i+1, chunk)
+	}
+	return out.String(), nil
+}
+
+// chunkWriter records every write it receives.
+type chunkWriter struct {
+	chunks []string
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.chunks = append(w.chunks, string(p))
+	return len(p), nil
+}
+
+// failingWriter accepts the first accept writes and fails every later one.
+type failingWriter struct {
+	accept int
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes > w.accept {
+		return 0, errors.New("disk full")
+	}
+	return len(p), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/isaeken/brickengine-go/runtime"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runTree renders examples/trees/skeleton with the vars in file into a copy of
+// examples/trees/existing and describes the result: the action and mode of
+// every file, and the content of those created or updated. Files containing
+// "dry_run" render in dry-run mode and list the diffs instead, checking that
+// the destination was left alone.
+func runTree(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(content, &vars); err != nil {
+		return "", err
+	}
+
+	root := filepath.Dir(file)
+	dst, err := os.MkdirTemp("", "brick-tree-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dst)
+	if err := os.CopyFS(dst, os.DirFS(filepath.Join(root, "existing"))); err != nil {
+		return "", err
+	}
+	before, err := snapshotTree(dst)
+	if err != nil {
+		return "", err
+	}
+
+	dryRun := strings.Contains(filepath.Base(file), "dry_run")
+	files, err := runtime.RenderTree(os.DirFS(filepath.Join(root, "skeleton")), dst, runtime.Context{"vars": vars}, runtime.RenderTreeOptions{
+		Functions: runtime.DefaultFunctions(),
+		Options:   optionsFor(file),
+		Patterns:  []string{"*.conf", "*.service"},
+		DryRun:    dryRun,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, f := range files {
+		kind := "copied"
+		if f.Rendered {
+			kind = "rendered"
+		}
+		if dryRun {
+			fmt.Fprintf(&out, "%-9s %s (%s)\n", f.Action, f.Path, kind)
+			out.WriteString(f.Diff)
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(dst, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "%-9s %s (%s, %s)\n", f.Action, f.Path, kind, info.Mode().Perm())
+		if f.Action != runtime.FileUnchanged {
+			written, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(f.Path)))
+			if err != nil {
+				return "", err
+			}
+			out.Write(written)
+		}
+	}
+
+	if dryRun {
+		after, err := snapshotTree(dst)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "destination untouched: %t", after == before)
+	}
+	return out.String(), nil
+}
+
+// snapshotTree lists the files under dir with their modes and contents.
+func snapshotTree(dir string) (string, error) {
+	var out strings.Builder
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&out, "%s %s\n%s\n", p, info.Mode(), content)
+		return nil
+	})
+	return out.String(), err
+}
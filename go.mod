@@ -3,7 +3,12 @@ module github.com/isaeken/brickengine-go
 go 1.23.5
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/gosimple/slug v1.15.0 // indirect
-	github.com/gosimple/unidecode v1.0.1 // indirect
+	github.com/BurntSushi/toml v1.5.0
+	github.com/google/uuid v1.6.0
+	github.com/gosimple/slug v1.15.0
+	golang.org/x/crypto v0.36.0
+	gopkg.in/ini.v1 v1.67.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/gosimple/unidecode v1.0.1 // indirect
@@ -8,6 +8,8 @@ import (
 type Token struct {
 	Type    TokenType
 	Literal string
+	// Line is the 1-based line the token starts on.
+	Line int
 }
 
 type Lexer struct {
@@ -15,6 +17,7 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	line         int
 }
 
 func New(input string) *Lexer {
@@ -24,6 +27,9 @@ func New(input string) *Lexer {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' || l.readPosition == 0 {
+		l.line++
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // null byte
 	} else {
@@ -37,6 +43,13 @@ func (l *Lexer) NextToken() Token {
 	l.skipWhitespace()
 	l.skipComment()
 
+	line := l.line
+	tok := l.readToken()
+	tok.Line = line
+	return tok
+}
+
+func (l *Lexer) readToken() Token {
 	switch l.ch {
 	case 0:
 		return Token{Type: EOF, Literal: ""}
@@ -73,6 +86,12 @@ func (l *Lexer) NextToken() Token {
 	case '.':
 		l.readChar()
 		return Token{Type: DOT, Literal: "."}
+	case '?':
+		if l.peekChar() == '.' {
+			l.readChar()
+			l.readChar()
+			return Token{Type: OPTIONAL_DOT, Literal: "?."}
+		}
 	case '(':
 		l.readChar()
 		return Token{Type: LPAREN, Literal: "("}
@@ -179,11 +198,16 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[start:l.position]
 }
 
+// readNumber reads a number including a unit suffix such as "GiB" in
+// "1GiB"; the parser validates the unit.
 func (l *Lexer) readNumber() string {
 	start := l.position
 	for isDigit(l.ch) || l.ch == '.' || l.ch == 'e' || l.ch == '+' || l.ch == '-' {
 		l.readChar()
 	}
+	for isLetter(l.ch) {
+		l.readChar()
+	}
 	return l.input[start:l.position]
 }
 
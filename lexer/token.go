@@ -6,23 +6,24 @@ const (
 	ILLEGAL TokenType = "ILLEGAL"
 	EOF               = "EOF"
 
-	IDENT      = "IDENT"
-	NUMBER     = "NUMBER"
-	STRING     = "STRING"
-	OPERATOR   = "OPERATOR"
-	PIPE       = "PIPE"
-	DOT        = "DOT"
-	LPAREN     = "LPAREN"
-	RPAREN     = "RPAREN"
-	LBRACKET   = "LBRACKET"
-	RBRACKET   = "RBRACKET"
-	LBRACE     = "LBRACE"
-	RBRACE     = "RBRACE"
-	COMMA      = "COMMA"
-	EXPR_OPEN  = "EXPR_OPEN"
-	EXPR_CLOSE = "EXPR_CLOSE"
-	SEMICOLON  = "SEMICOLON"
-	COLON      = "COLON"
+	IDENT        = "IDENT"
+	NUMBER       = "NUMBER"
+	STRING       = "STRING"
+	OPERATOR     = "OPERATOR"
+	PIPE         = "PIPE"
+	DOT          = "DOT"
+	OPTIONAL_DOT = "OPTIONAL_DOT"
+	LPAREN       = "LPAREN"
+	RPAREN       = "RPAREN"
+	LBRACKET     = "LBRACKET"
+	RBRACKET     = "RBRACKET"
+	LBRACE       = "LBRACE"
+	RBRACE       = "RBRACE"
+	COMMA        = "COMMA"
+	EXPR_OPEN    = "EXPR_OPEN"
+	EXPR_CLOSE   = "EXPR_CLOSE"
+	SEMICOLON    = "SEMICOLON"
+	COLON        = "COLON"
 
 	RETURN = "RETURN"
 	LET    = "LET"
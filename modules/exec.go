@@ -0,0 +1,237 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultExecTimeout bounds a command when ExecRequest.Timeout is not set.
+const DefaultExecTimeout = 5 * time.Minute
+
+// DefaultExecOutputBytes caps stdout and stderr when ExecPolicy does not.
+const DefaultExecOutputBytes = 1 << 20
+
+// ExecRequest describes a command to run. Command is run directly with Args
+// unless Shell is set, in which case Command is a script for /bin/sh -c.
+type ExecRequest struct {
+	Command string
+	Args    []string
+	Shell   bool
+	// Env holds "KEY=value" entries. The command's environment is only the
+	// host's PATH plus these entries.
+	Env     []string
+	Dir     string
+	Stdin   []byte
+	Timeout time.Duration
+	// MaxOutputBytes caps stdout and stderr each; output beyond it is
+	// dropped and Truncated is set.
+	MaxOutputBytes int
+}
+
+// ExecResult is the outcome of a command that ran. A non-zero exit code is
+// a result, not an error.
+type ExecResult struct {
+	Stdout    []byte
+	Stderr    []byte
+	ExitCode  int
+	Duration  time.Duration
+	Truncated bool
+}
+
+// Executor runs commands for the exec functions. Hosts substitute fakes in
+// tests and dry runs.
+type Executor interface {
+	Run(ctx context.Context, req ExecRequest) (*ExecResult, error)
+}
+
+// ExecutorFunc adapts a function to the Executor interface.
+type ExecutorFunc func(ctx context.Context, req ExecRequest) (*ExecResult, error)
+
+func (f ExecutorFunc) Run(ctx context.Context, req ExecRequest) (*ExecResult, error) {
+	return f(ctx, req)
+}
+
+// ExecPolicy restricts the commands scripts may run.
+type ExecPolicy struct {
+	// AllowedCommands lists the commands that may run. Bare names such as
+	// "systemctl" allow that name looked up in PATH; paths allow exactly
+	// that binary. Empty allows nothing.
+	AllowedCommands []string
+	// AllowShell permits requests with Shell set, which bypass
+	// AllowedCommands.
+	AllowShell bool
+	// AllowedEnv lists the environment variables requests may set. Empty
+	// allows none. Listing PATH or loader variables such as LD_PRELOAD lets
+	// scripts choose what an allowed command actually runs.
+	AllowedEnv []string
+	// AllowedDirs lists the directories, and their subdirectories, requests
+	// may run in. Empty allows only the host's working directory.
+	AllowedDirs []string
+	// MaxOutputBytes caps stdout and stderr each. Zero uses
+	// DefaultExecOutputBytes.
+	MaxOutputBytes int
+}
+
+// Check reports whether policy allows req.
+func (p ExecPolicy) Check(req ExecRequest) error {
+	if err := p.checkCommand(req); err != nil {
+		return err
+	}
+	for _, entry := range req.Env {
+		name, _, _ := strings.Cut(entry, "=")
+		if !p.envAllowed(name) {
+			return fmt.Errorf("environment variable '%s' is not allowed", name)
+		}
+	}
+	if req.Dir != "" && !p.dirAllowed(req.Dir) {
+		return fmt.Errorf("working directory '%s' is not allowed", req.Dir)
+	}
+	return nil
+}
+
+func (p ExecPolicy) checkCommand(req ExecRequest) error {
+	if req.Shell {
+		if !p.AllowShell {
+			return errors.New("shell commands are not allowed")
+		}
+		return nil
+	}
+	for _, allowed := range p.AllowedCommands {
+		if req.Command == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("command '%s' is not allowed", req.Command)
+}
+
+func (p ExecPolicy) envAllowed(name string) bool {
+	for _, allowed := range p.AllowedEnv {
+		if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// dirAllowed reports whether dir is one of AllowedDirs or inside one. Paths
+// are compared lexically, so relative entries only match relative dirs.
+func (p ExecPolicy) dirAllowed(dir string) bool {
+	for _, allowed := range p.AllowedDirs {
+		if rel, err := filepath.Rel(allowed, dir); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// OSExecutor runs commands as host processes.
+type OSExecutor struct{}
+
+func (OSExecutor) Run(ctx context.Context, req ExecRequest) (*ExecResult, error) {
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name, args := req.Command, req.Args
+	if req.Shell {
+		name, args = "/bin/sh", append([]string{"-c", req.Command}, req.Args...)
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = req.Dir
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH")}, req.Env...)
+	if req.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(req.Stdin)
+	}
+
+	limit := req.MaxOutputBytes
+	if limit <= 0 {
+		limit = DefaultExecOutputBytes
+	}
+	stdout := &cappedBuffer{limit: limit}
+	stderr := &cappedBuffer{limit: limit}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	result := &ExecResult{
+		Stdout:    stdout.buf.Bytes(),
+		Stderr:    stderr.buf.Bytes(),
+		Duration:  time.Since(start),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%s: timed out after %s", req.Command, timeout)
+		}
+		return nil, fmt.Errorf("%s: %w", req.Command, ctxErr)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// cappedBuffer keeps the first limit bytes written to it.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.limit - c.buf.Len(); room < len(p) {
+		c.truncated = true
+		c.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+// DryRunExecutor records requests without running anything and reports
+// every command as successful with empty output.
+type DryRunExecutor struct {
+	mu       sync.Mutex
+	requests []ExecRequest
+}
+
+func (d *DryRunExecutor) Run(ctx context.Context, req ExecRequest) (*ExecResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests = append(d.requests, req)
+	return &ExecResult{}, nil
+}
+
+// Requests returns the recorded requests.
+func (d *DryRunExecutor) Requests() []ExecRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]ExecRequest(nil), d.requests...)
+}
+
+// Commands returns the recorded requests as command lines, e.g. for a plan
+// printed before the real run.
+func (d *DryRunExecutor) Commands() []string {
+	var lines []string
+	for _, req := range d.Requests() {
+		lines = append(lines, strings.TrimSpace(req.Command+" "+strings.Join(req.Args, " ")))
+	}
+	return lines
+}
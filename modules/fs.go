@@ -0,0 +1,282 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+	"time"
+)
+
+// ErrReadOnly is returned by the write operations of read-only file systems.
+var ErrReadOnly = errors.New("file system is read-only")
+
+// FileSystem is the storage behind the fs functions. Names are slash
+// separated paths relative to the root, as accepted by fs.ValidPath.
+type FileSystem interface {
+	fs.StatFS
+	fs.ReadDirFS
+	fs.ReadFileFS
+	// WriteFile creates or replaces a file, creating missing parent
+	// directories.
+	WriteFile(name string, data []byte) error
+	MkdirAll(name string) error
+	// RemoveAll removes a file or a directory tree. Symbolic links are
+	// removed, not followed.
+	RemoveAll(name string) error
+}
+
+// CleanPath converts a script path to a name for FileSystem: a leading "/"
+// refers to the root and "." segments are dropped. Paths that would leave
+// the root through ".." are rejected.
+func CleanPath(p string) (string, error) {
+	slashed := strings.ReplaceAll(p, "\\", "/")
+	for _, seg := range strings.Split(slashed, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("path '%s' escapes the root", p)
+		}
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+slashed), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, nil
+}
+
+// ReadOnlyFS exposes fsys, e.g. an embed.FS or os.DirFS, as a FileSystem
+// whose write operations fail with ErrReadOnly.
+func ReadOnlyFS(fsys fs.FS) FileSystem {
+	return readOnlyFS{fsys}
+}
+
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+func (r readOnlyFS) Open(name string) (fs.File, error)          { return r.fsys.Open(name) }
+func (r readOnlyFS) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(r.fsys, name) }
+func (r readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(r.fsys, name) }
+func (r readOnlyFS) ReadFile(name string) ([]byte, error)       { return fs.ReadFile(r.fsys, name) }
+
+func (readOnlyFS) WriteFile(name string, data []byte) error {
+	return &fs.PathError{Op: "write", Path: name, Err: ErrReadOnly}
+}
+
+func (readOnlyFS) MkdirAll(name string) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: ErrReadOnly}
+}
+
+func (readOnlyFS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+// DirFS is a FileSystem rooted at a host directory. Symbolic links are
+// followed only while they stay inside the root, and errors report paths
+// relative to the root.
+type DirFS struct {
+	root string
+}
+
+// NewDirFS returns a read-write FileSystem rooted at root. Wrap it with
+// ReadOnlyFS for read-only access.
+func NewDirFS(root string) (*DirFS, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	return &DirFS{root: real}, nil
+}
+
+// resolve returns the host path of name with symbolic links resolved,
+// failing if it leaves the root. Missing trailing elements are allowed so
+// files can be created.
+func (d *DirFS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	existing := filepath.Join(d.root, filepath.FromSlash(name))
+	var missing []string
+	for existing != d.root {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		missing = append([]string{filepath.Base(existing)}, missing...)
+		existing = filepath.Dir(existing)
+	}
+
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if real != d.root && !strings.HasPrefix(real, d.root+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: op, Path: name, Err: errors.New("path escapes the root")}
+	}
+	return filepath.Join(append([]string{real}, missing...)...), nil
+}
+
+// relErr replaces host paths in err with name.
+func relErr(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return &fs.PathError{Op: op, Path: name, Err: pathErr.Err}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (d *DirFS) Open(name string) (fs.File, error) {
+	p, err := d.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, relErr("open", name, err)
+	}
+	return f, nil
+}
+
+func (d *DirFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := d.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	return info, relErr("stat", name, err)
+}
+
+func (d *DirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := d.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(p)
+	return entries, relErr("readdir", name, err)
+}
+
+func (d *DirFS) ReadFile(name string) ([]byte, error) {
+	p, err := d.resolve("read", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	return data, relErr("read", name, err)
+}
+
+func (d *DirFS) WriteFile(name string, data []byte) error {
+	if name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := d.MkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	p, err := d.resolve("write", name)
+	if err != nil {
+		return err
+	}
+	return relErr("write", name, os.WriteFile(p, data, 0o644))
+}
+
+func (d *DirFS) MkdirAll(name string) error {
+	p, err := d.resolve("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return relErr("mkdir", name, os.MkdirAll(p, 0o755))
+}
+
+func (d *DirFS) RemoveAll(name string) error {
+	if name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("cannot remove the root")}
+	}
+	// resolve the parent only, so a link is removed rather than its target
+	dir, err := d.resolve("remove", path.Dir(name))
+	if err != nil {
+		return err
+	}
+	return relErr("remove", name, os.RemoveAll(filepath.Join(dir, path.Base(name))))
+}
+
+// MemFS is an in-memory FileSystem for tests and dry runs.
+type MemFS struct {
+	files fstest.MapFS
+}
+
+// NewMemFS returns a MemFS holding files, keyed by slash separated path.
+func NewMemFS(files map[string]string) *MemFS {
+	m := &MemFS{files: fstest.MapFS{}}
+	for name, data := range files {
+		m.files[name] = &fstest.MapFile{Data: []byte(data), Mode: 0o644, ModTime: time.Now()}
+	}
+	return m
+}
+
+func (m *MemFS) Open(name string) (fs.File, error)          { return m.files.Open(name) }
+func (m *MemFS) Stat(name string) (fs.FileInfo, error)      { return m.files.Stat(name) }
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) { return m.files.ReadDir(name) }
+func (m *MemFS) ReadFile(name string) ([]byte, error)       { return m.files.ReadFile(name) }
+
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if info, err := m.files.Stat(name); err == nil && info.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+	}
+	if err := m.MkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	m.files[name] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: 0o644, ModTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		info, err := m.files.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+			}
+			continue
+		}
+		m.files[dir] = &fstest.MapFile{Mode: fs.ModeDir | 0o755, ModTime: time.Now()}
+	}
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("cannot remove the root")}
+	}
+	for p := range m.files {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(m.files, p)
+		}
+	}
+	return nil
+}
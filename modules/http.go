@@ -1,27 +1,191 @@
 package modules
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
+// DefaultHttpTimeout bounds a request when HttpRequest.Timeout is not set.
+const DefaultHttpTimeout = 30 * time.Second
+
+// DefaultMaxRedirects is the number of redirects followed by default.
+const DefaultMaxRedirects = 10
+
+// HttpRequest describes a single request made by HttpDo.
+type HttpRequest struct {
+	Method string
+	URL    string
+	// Headers and Query are applied in order; Query is appended to any query
+	// string already present in URL.
+	Headers [][2]string
+	Query   [][2]string
+	Body    []byte
+	// ContentType is sent unless Headers sets Content-Type explicitly.
+	ContentType string
+	Timeout     time.Duration
+	// MaxRedirects is the number of redirects to follow; 0 uses
+	// DefaultMaxRedirects and a negative value disables redirects, returning
+	// the redirect response itself.
+	MaxRedirects int
+}
+
+// HttpResponse is the result of a request. Header names are lower case and
+// repeated headers are joined with ", ".
 type HttpResponse struct {
-	Status int
-	Body   map[string]interface{}
+	Status     int
+	StatusText string
+	Headers    [][2]string
+	Body       []byte
+	URL        string
 }
 
-func HttpGet(url string) interface{} {
-	resp, err := http.Get(url)
+// HttpDo performs req using client, or http.DefaultClient's transport when
+// client is nil. Only transport failures, timeouts and redirect limits are
+// errors; any HTTP status is returned as a response.
+func HttpDo(ctx context.Context, client *http.Client, req HttpRequest) (*HttpResponse, error) {
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	u, err := url.Parse(req.URL)
 	if err != nil {
-		return map[string]interface{}{"error": err.Error()}
+		return nil, fmt.Errorf("invalid url '%s'", req.URL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme '%s'", u.Scheme)
+	}
+	if len(req.Query) > 0 {
+		q := u.RawQuery
+		for _, kv := range req.Query {
+			if q != "" {
+				q += "&"
+			}
+			q += url.QueryEscape(kv[0]) + "=" + url.QueryEscape(kv[1])
+		}
+		u.RawQuery = q
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHttpTimeout
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var body io.Reader
+	if req.Body != nil {
+		body = bytes.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if req.ContentType != "" {
+		httpReq.Header.Set("Content-Type", req.ContentType)
+	}
+	for _, kv := range req.Headers {
+		if strings.EqualFold(kv[0], "host") {
+			httpReq.Host = kv[1]
+			continue
+		}
+		httpReq.Header.Set(kv[0], kv[1])
+	}
+
+	c := redirectClient(client, req.MaxRedirects)
+	resp, err := c.Do(httpReq)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%s %s: timed out after %s", method, req.URL, timeout)
+		}
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("%s %s: %w", method, req.URL, err)
 	}
 	defer resp.Body.Close()
 
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%s %s: timed out after %s", method, req.URL, timeout)
+		}
+		return nil, fmt.Errorf("%s %s: reading body: %w", method, req.URL, err)
+	}
+
+	return &HttpResponse{
+		Status:     resp.StatusCode,
+		StatusText: strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+		Headers:    responseHeaders(resp.Header),
+		Body:       data,
+		URL:        resp.Request.URL.String(),
+	}, nil
+}
+
+// HttpGet fetches rawURL and returns a map with its "status" and JSON-decoded
+// "body", or with an "error" key if the request fails.
+//
+// Deprecated: use HttpDo, which reports errors as errors and returns the raw
+// body and headers.
+func HttpGet(rawURL string) interface{} {
+	resp, err := HttpDo(context.Background(), nil, HttpRequest{Method: http.MethodGet, URL: rawURL})
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+
 	var body map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&body)
+	json.Unmarshal(resp.Body, &body)
 
 	return map[string]interface{}{
-		"status": resp.StatusCode,
+		"status": resp.Status,
 		"body":   body,
 	}
 }
+
+// redirectClient returns a copy of client that follows at most max redirects.
+func redirectClient(client *http.Client, max int) *http.Client {
+	c := &http.Client{}
+	if client != nil {
+		*c = *client
+	}
+	if max == 0 {
+		max = DefaultMaxRedirects
+	}
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if max < 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > max {
+			return fmt.Errorf("stopped after %d redirects", max)
+		}
+		return nil
+	}
+	return c
+}
+
+func responseHeaders(h http.Header) [][2]string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := make([][2]string, 0, len(names))
+	for _, name := range names {
+		headers = append(headers, [2]string{strings.ToLower(name), strings.Join(h[name], ", ")})
+	}
+	return headers
+}
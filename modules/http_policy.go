@@ -0,0 +1,239 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// HttpPolicy restricts the requests scripts may make.
+type HttpPolicy struct {
+	// AllowedHosts lists host names requests may go to; "*.example.com"
+	// matches any subdomain. When AllowedHosts or AllowedCIDRs is set, a
+	// request must match one of them.
+	AllowedHosts []string
+	// AllowedCIDRs lists networks requests may connect to. Addresses in
+	// these networks are allowed even when BlockPrivate is set.
+	AllowedCIDRs []string
+	// BlockPrivate rejects loopback, private, link-local, shared and
+	// unspecified addresses, e.g. cloud metadata endpoints.
+	BlockPrivate bool
+	// MaxResponseBytes caps the size of a response body. Zero means no
+	// limit.
+	MaxResponseBytes int64
+	// MaxRequests caps the number of requests in a single run. Zero means
+	// no limit.
+	MaxRequests int
+	// New fields must be covered by IsZero, or they are not enforced when
+	// they are the only ones set.
+}
+
+// IsZero reports whether p restricts nothing, so requests may skip the
+// policy transport.
+func (p HttpPolicy) IsZero() bool {
+	return len(p.AllowedHosts) == 0 &&
+		len(p.AllowedCIDRs) == 0 &&
+		!p.BlockPrivate &&
+		p.MaxResponseBytes == 0 &&
+		p.MaxRequests == 0
+}
+
+// blockedRanges are the networks rejected by HttpPolicy.BlockPrivate in
+// addition to those reported by net.IP's classification methods.
+var blockedRanges = mustParseCIDRs(
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"64:ff9b::/96",  // NAT64, may embed private IPv4 addresses
+)
+
+// NewHttpPolicyTransport returns a transport that enforces policy before
+// passing requests to base. When base is nil, a copy of
+// http.DefaultTransport is used that also checks the address it actually
+// connects to, so host names re-resolving to blocked addresses are caught.
+func NewHttpPolicyTransport(base http.RoundTripper, policy HttpPolicy) (http.RoundTripper, error) {
+	cidrs, err := parseCIDRs(policy.AllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	t := &policyTransport{policy: policy, allowedNets: cidrs}
+
+	if base == nil {
+		dialer := &net.Dialer{
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				return t.checkAddress(net.ParseIP(host))
+			},
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = dialer.DialContext
+		base = transport
+	}
+	t.base = base
+	return t, nil
+}
+
+type policyTransport struct {
+	base        http.RoundTripper
+	policy      HttpPolicy
+	allowedNets []*net.IPNet
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || t.policy.MaxResponseBytes <= 0 {
+		return resp, err
+	}
+	if resp.ContentLength > t.policy.MaxResponseBytes {
+		resp.Body.Close()
+		return nil, fmt.Errorf("response body exceeds %d bytes", t.policy.MaxResponseBytes)
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, limit: t.policy.MaxResponseBytes, remaining: t.policy.MaxResponseBytes}
+	return resp, nil
+}
+
+// checkHost checks a host name or literal address. Host names are resolved
+// so every address they point to is checked.
+func (t *policyTransport) checkHost(ctx context.Context, host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		return t.checkIP(ip)
+	}
+
+	hostAllowed := t.hostAllowed(host)
+	restricted := len(t.policy.AllowedHosts) > 0 || len(t.allowedNets) > 0
+	if restricted && !hostAllowed && len(t.allowedNets) == 0 {
+		return fmt.Errorf("host '%s' is not allowed", host)
+	}
+	if !t.policy.BlockPrivate && (hostAllowed || !restricted) {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if t.policy.BlockPrivate && isBlockedIP(addr.IP) && !t.inAllowedNets(addr.IP) {
+			return fmt.Errorf("host '%s' resolves to blocked address %s", host, addr.IP)
+		}
+		if restricted && !hostAllowed && !t.inAllowedNets(addr.IP) {
+			return fmt.Errorf("host '%s' is not allowed", host)
+		}
+	}
+	return nil
+}
+
+// checkIP checks a literal address in a request URL.
+func (t *policyTransport) checkIP(ip net.IP) error {
+	if err := t.checkAddress(ip); err != nil {
+		return err
+	}
+	restricted := len(t.policy.AllowedHosts) > 0 || len(t.allowedNets) > 0
+	if restricted && !t.inAllowedNets(ip) && !t.hostAllowed(ip.String()) {
+		return fmt.Errorf("address %s is not allowed", ip)
+	}
+	return nil
+}
+
+// checkAddress applies BlockPrivate to an address about to be connected to.
+func (t *policyTransport) checkAddress(ip net.IP) error {
+	if ip == nil {
+		return fmt.Errorf("invalid address")
+	}
+	if t.policy.BlockPrivate && isBlockedIP(ip) && !t.inAllowedNets(ip) {
+		return fmt.Errorf("address %s is blocked", ip)
+	}
+	return nil
+}
+
+func (t *policyTransport) hostAllowed(host string) bool {
+	for _, pattern := range t.policy.AllowedHosts {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *policyTransport) inAllowedNets(ip net.IP) bool {
+	for _, n := range t.allowedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, n := range blockedRanges {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr '%s'", cidr)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// limitedBody fails reads once more than limit bytes have been read.
+type limitedBody struct {
+	io.ReadCloser
+	limit, remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, fmt.Errorf("response body exceeds %d bytes", b.limit)
+	}
+	return n, err
+}
@@ -0,0 +1,186 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// HttpInteraction is a recorded request and its response.
+type HttpInteraction struct {
+	Request  HttpRecordedRequest  `json:"request"`
+	Response HttpRecordedResponse `json:"response"`
+}
+
+type HttpRecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type HttpRecordedResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// HttpRecording is a list of interactions, stored as JSON.
+type HttpRecording struct {
+	Interactions []HttpInteraction `json:"interactions"`
+}
+
+// LoadHttpRecording reads a recording written by HttpRecorder.Save.
+func LoadHttpRecording(path string) (*HttpRecording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec HttpRecording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+	}
+	return &rec, nil
+}
+
+// HttpRecorder is a transport that passes requests to a base transport and
+// records every interaction.
+type HttpRecorder struct {
+	base http.RoundTripper
+
+	mu  sync.Mutex
+	rec HttpRecording
+}
+
+// NewHttpRecorder records the requests made through base, or
+// http.DefaultTransport when base is nil.
+func NewHttpRecorder(base http.RoundTripper) *HttpRecorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &HttpRecorder{base: base}
+}
+
+func (r *HttpRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	headers := map[string]string{}
+	for name, values := range resp.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+
+	r.mu.Lock()
+	r.rec.Interactions = append(r.rec.Interactions, HttpInteraction{
+		Request:  recorded,
+		Response: HttpRecordedResponse{Status: resp.StatusCode, Headers: headers, Body: string(body)},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Recording returns the interactions recorded so far.
+func (r *HttpRecorder) Recording() HttpRecording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return HttpRecording{Interactions: append([]HttpInteraction(nil), r.rec.Interactions...)}
+}
+
+// Save writes the recording as indented JSON.
+func (r *HttpRecorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.Recording(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// HttpReplayer is a transport that answers requests from a recording without
+// touching the network. Interactions are matched by method, URL and body and
+// replayed in order when the same request was recorded more than once.
+type HttpReplayer struct {
+	mu   sync.Mutex
+	rec  *HttpRecording
+	used []bool
+}
+
+func NewHttpReplayer(rec *HttpRecording) *HttpReplayer {
+	return &HttpReplayer{rec: rec, used: make([]bool, len(rec.Interactions))}
+}
+
+func (r *HttpReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := -1
+	for i, in := range r.rec.Interactions {
+		if in.Request != recorded {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("no recorded response for %s %s", recorded.Method, recorded.URL)
+	}
+	r.used[match] = true
+
+	in := r.rec.Interactions[match].Response
+	header := http.Header{}
+	for name, value := range in.Headers {
+		header.Set(name, value)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(in.Body)),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}, nil
+}
+
+// recordRequest captures the parts of req that identify it in a recording,
+// restoring the body for the transport that sends it.
+func recordRequest(req *http.Request) (HttpRecordedRequest, error) {
+	recorded := HttpRecordedRequest{Method: req.Method, URL: req.URL.String()}
+	if req.Body == nil || req.Body == http.NoBody {
+		return recorded, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return recorded, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	recorded.Body = string(body)
+	return recorded, nil
+}
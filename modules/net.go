@@ -0,0 +1,208 @@
+package modules
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+func parsePrefix(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR '%s'", cidr)
+	}
+	return prefix.Masked(), nil
+}
+
+func parseAddr(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid IP address '%s'", ip)
+	}
+	return addr.Unmap(), nil
+}
+
+func addrToInt(addr netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(addr.AsSlice())
+}
+
+func intToAddr(n *big.Int, bits int) (netip.Addr, error) {
+	if n.Sign() < 0 || n.BitLen() > bits {
+		return netip.Addr{}, fmt.Errorf("%s is outside the address range", n)
+	}
+	buf := make([]byte, bits/8)
+	n.FillBytes(buf)
+	addr, _ := netip.AddrFromSlice(buf)
+	return addr, nil
+}
+
+// hostCount returns the number of addresses in prefix.
+func hostCount(prefix netip.Prefix) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+}
+
+// IPInCIDR reports whether ip is inside the network cidr.
+func IPInCIDR(ip, cidr string) (bool, error) {
+	addr, err := parseAddr(ip)
+	if err != nil {
+		return false, err
+	}
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return false, err
+	}
+	return prefix.Contains(addr), nil
+}
+
+// CIDRHost returns the n-th address of cidr. Negative numbers count back from
+// the last address, so -1 is the broadcast address of an IPv4 network.
+func CIDRHost(cidr string, n int) (string, error) {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	count := hostCount(prefix)
+	num := big.NewInt(int64(n))
+	if n < 0 {
+		num.Add(num, count)
+	}
+	if num.Sign() < 0 || num.Cmp(count) >= 0 {
+		return "", fmt.Errorf("host number %d is out of range for %s", n, prefix)
+	}
+
+	addr, err := intToAddr(num.Add(num, addrToInt(prefix.Addr())), prefix.Addr().BitLen())
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// CIDRSubnet splits cidr into subnets newbits longer and returns subnet
+// number netnum, e.g. CIDRSubnet("10.0.0.0/16", 8, 2) is "10.0.2.0/24".
+func CIDRSubnet(cidr string, newbits, netnum int) (string, error) {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	bits := prefix.Bits() + newbits
+	if newbits < 0 || bits > prefix.Addr().BitLen() {
+		return "", fmt.Errorf("cannot extend %s by %d bits", prefix, newbits)
+	}
+	if netnum < 0 || big.NewInt(int64(netnum)).BitLen() > newbits {
+		return "", fmt.Errorf("network number %d does not fit in %d bits", netnum, newbits)
+	}
+
+	offset := new(big.Int).Lsh(big.NewInt(int64(netnum)), uint(prefix.Addr().BitLen()-bits))
+	addr, err := intToAddr(offset.Add(offset, addrToInt(prefix.Addr())), prefix.Addr().BitLen())
+	if err != nil {
+		return "", err
+	}
+	return netip.PrefixFrom(addr, bits).String(), nil
+}
+
+// CIDRNetmask returns the netmask of cidr in address notation.
+func CIDRNetmask(cidr string) (string, error) {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+	mask := net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen())
+	addr, _ := netip.AddrFromSlice(mask)
+	return addr.String(), nil
+}
+
+// CIDRBroadcast returns the last address of cidr, which is the broadcast
+// address of an IPv4 network.
+func CIDRBroadcast(cidr string) (string, error) {
+	return CIDRHost(cidr, -1)
+}
+
+// IPToInt converts an IPv4 address to a number and an IPv6 address to a
+// decimal string, as IPv6 addresses do not fit in a float64.
+func IPToInt(ip string) (interface{}, error) {
+	addr, err := parseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	n := addrToInt(addr)
+	if addr.Is4() {
+		return float64(n.Uint64()), nil
+	}
+	return n.String(), nil
+}
+
+// IntToIP converts a number or a decimal string to an address. Values above
+// the IPv4 range produce IPv6 addresses.
+func IntToIP(v interface{}) (string, error) {
+	n := new(big.Int)
+	switch val := v.(type) {
+	case float64:
+		if val != float64(int64(val)) {
+			return "", fmt.Errorf("invalid address number %v", val)
+		}
+		n.SetInt64(int64(val))
+	case string:
+		if _, ok := n.SetString(strings.TrimSpace(val), 10); !ok {
+			return "", fmt.Errorf("invalid address number '%s'", val)
+		}
+	default:
+		return "", fmt.Errorf("invalid address number %v", v)
+	}
+
+	bits := 32
+	if n.BitLen() > 32 {
+		bits = 128
+	}
+	addr, err := intToAddr(n, bits)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// RandomIPv4In returns a random address inside an IPv4 network. The network
+// and broadcast addresses are skipped for networks larger than /31.
+func RandomIPv4In(rng *rand.Rand, cidr string) (string, error) {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+	if !prefix.Addr().Is4() {
+		return "", fmt.Errorf("'%s' is not an IPv4 network", cidr)
+	}
+
+	first, count := int64(0), hostCount(prefix).Int64()
+	if prefix.Bits() < 31 {
+		first, count = 1, count-2
+	}
+	return CIDRHost(prefix.String(), int(first+rng.Int63n(count)))
+}
+
+// RandomMAC returns a random unicast MAC address. A non-empty oui fixes the
+// first three bytes; local sets the locally-administered bit, which is
+// otherwise cleared for random prefixes and kept as given in an oui.
+func RandomMAC(rng *rand.Rand, oui string, local bool) (string, error) {
+	mac := make(net.HardwareAddr, 6)
+	rng.Read(mac)
+
+	if oui != "" {
+		prefix, err := net.ParseMAC(strings.ReplaceAll(strings.TrimSpace(oui), "-", ":") + ":00:00:00")
+		if err != nil {
+			return "", fmt.Errorf("invalid OUI '%s'", oui)
+		}
+		copy(mac, prefix[:3])
+	}
+
+	mac[0] &^= 0x01
+	if local {
+		mac[0] |= 0x02
+	} else if oui == "" {
+		mac[0] &^= 0x02
+	}
+	return mac.String(), nil
+}
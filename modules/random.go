@@ -0,0 +1,141 @@
+package modules
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// PasswordPolicy describes the characters Password draws from. Each enabled
+// class contributes at least its minimum number of characters.
+type PasswordPolicy struct {
+	Lower, Upper, Digits bool
+	// Symbols lists the symbol characters to use; empty disables symbols.
+	Symbols string
+	// MinLower, MinUpper, MinDigits and MinSymbols are the minimum number
+	// of characters of each enabled class.
+	MinLower, MinUpper, MinDigits, MinSymbols int
+	// Exclude lists characters that must not appear, e.g. "O0l1".
+	Exclude string
+}
+
+// DefaultSymbols are the symbols used when symbols are enabled without an
+// explicit set.
+const DefaultSymbols = "!@#$%^&*()-_=+[]{}:,.?"
+
+// DefaultPasswordPolicy uses lower and upper case letters and digits, at least
+// one of each.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		Lower: true, Upper: true, Digits: true,
+		MinLower: 1, MinUpper: 1, MinDigits: 1, MinSymbols: 1,
+	}
+}
+
+// SecureRandomBytes returns n bytes from crypto/rand.
+func SecureRandomBytes(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid byte count %d", n)
+	}
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SecureRandomInt returns a uniformly distributed integer in [min, max] from
+// crypto/rand.
+func SecureRandomInt(min, max int64) (int64, error) {
+	if min > max {
+		return 0, fmt.Errorf("min %d is greater than max %d", min, max)
+	}
+	// the span overflows int64 for ranges wider than half of it
+	span := new(big.Int).Sub(big.NewInt(max), big.NewInt(min))
+	n, err := rand.Int(rand.Reader, span.Add(span, big.NewInt(1)))
+	if err != nil {
+		return 0, err
+	}
+	return n.Add(n, big.NewInt(min)).Int64(), nil
+}
+
+// Password generates a password of length characters from crypto/rand that
+// satisfies policy.
+func Password(length int, policy PasswordPolicy) (string, error) {
+	type class struct {
+		chars []rune
+		min   int
+	}
+
+	var classes []class
+	add := func(enabled bool, chars string, min int) {
+		chars = removeChars(chars, policy.Exclude)
+		if enabled && chars != "" {
+			classes = append(classes, class{[]rune(chars), max(min, 0)})
+		}
+	}
+	add(policy.Lower, "abcdefghijklmnopqrstuvwxyz", policy.MinLower)
+	add(policy.Upper, "ABCDEFGHIJKLMNOPQRSTUVWXYZ", policy.MinUpper)
+	add(policy.Digits, "0123456789", policy.MinDigits)
+	add(policy.Symbols != "", policy.Symbols, policy.MinSymbols)
+
+	if len(classes) == 0 {
+		return "", fmt.Errorf("password policy allows no characters")
+	}
+
+	var all []rune
+	required := 0
+	for _, c := range classes {
+		all = append(all, c.chars...)
+		required += c.min
+	}
+	if required > length {
+		return "", fmt.Errorf("password length %d is shorter than the %d required characters", length, required)
+	}
+
+	out := make([]rune, 0, length)
+	pick := func(chars []rune) error {
+		i, err := SecureRandomInt(0, int64(len(chars)-1))
+		if err != nil {
+			return err
+		}
+		out = append(out, chars[i])
+		return nil
+	}
+
+	for _, c := range classes {
+		for i := 0; i < c.min; i++ {
+			if err := pick(c.chars); err != nil {
+				return "", err
+			}
+		}
+	}
+	for len(out) < length {
+		if err := pick(all); err != nil {
+			return "", err
+		}
+	}
+
+	// shuffle so the required characters are not at the front
+	for i := len(out) - 1; i > 0; i-- {
+		j, err := SecureRandomInt(0, int64(i))
+		if err != nil {
+			return "", err
+		}
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out), nil
+}
+
+func removeChars(s, exclude string) string {
+	if exclude == "" {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(exclude, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
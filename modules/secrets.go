@@ -0,0 +1,34 @@
+package modules
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSecretNotFound is returned by secret providers for unknown names.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider looks up secrets by name, e.g. "db/password", in a vault,
+// a cloud secret manager or files mounted by the orchestrator.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to the SecretProvider interface.
+type SecretProviderFunc func(ctx context.Context, name string) (string, error)
+
+func (f SecretProviderFunc) Secret(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// MapSecrets is a SecretProvider serving fixed values, for tests and local
+// runs.
+type MapSecrets map[string]string
+
+func (m MapSecrets) Secret(ctx context.Context, name string) (string, error) {
+	value, ok := m[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
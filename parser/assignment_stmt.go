@@ -37,7 +37,7 @@ func (p *Parser) parseAssignmentStmt() (Expression, error) {
 }
 
 func (p *Parser) tryAssignmentOrExpression() (Expression, error) {
-	savedToken := p.currentToken
+	savedToken, savedPeek, savedLexer := p.currentToken, p.peekToken, *p.lexer
 
 	left, err := p.parsePrimary()
 	if err != nil {
@@ -71,7 +71,7 @@ func (p *Parser) tryAssignmentOrExpression() (Expression, error) {
 		}, nil
 	}
 
-	p.currentToken = savedToken
-	p.peekToken = p.lexer.NextToken()
+	// not an assignment, parse again as an expression
+	p.currentToken, p.peekToken, *p.lexer = savedToken, savedPeek, savedLexer
 	return p.ParseExpression()
 }
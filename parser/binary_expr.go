@@ -18,7 +18,7 @@ func (b *BinaryExpr) String() string {
 func (p *Parser) parseBinaryExpr(precedence int) (Expression, error) {
 	left, err := p.parsePrimary()
 	if err != nil {
-		return nil, fmt.Errorf("invalid left-hand side of binary expression: %w", err)
+		return nil, err
 	}
 
 	for isOperator(p.currentToken.Type) {
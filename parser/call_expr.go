@@ -8,6 +8,8 @@ import (
 type CallExpr struct {
 	Target Expression
 	Args   []Expression
+	// Line is the line of the opening parenthesis.
+	Line int
 }
 
 func (c *CallExpr) String() string {
@@ -19,6 +21,7 @@ func (c *CallExpr) String() string {
 }
 
 func (p *Parser) parseCallExpr(target Expression) (Expression, error) {
+	line := p.currentToken.Line
 	p.nextToken()
 	args, err := p.parseArguments()
 	if err != nil {
@@ -27,5 +30,6 @@ func (p *Parser) parseCallExpr(target Expression) (Expression, error) {
 	return &CallExpr{
 		Target: target,
 		Args:   args,
+		Line:   line,
 	}, nil
 }
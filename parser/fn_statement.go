@@ -28,11 +28,26 @@ func (p *Parser) parseFnStatement() (Expression, error) {
 		return nil, fmt.Errorf("expected '(' after function name")
 	}
 
+	return p.parseFnSignature(name)
+}
+
+// parseFnLiteral parses an anonymous function such as `fn(x) { ... }` used as
+// a value.
+func (p *Parser) parseFnLiteral() (Expression, error) {
+	p.nextToken()
+	if p.currentToken.Type != lexer.LPAREN {
+		return nil, fmt.Errorf("expected '(' after 'fn', got '%s'", p.currentToken.Literal)
+	}
+
+	return p.parseFnSignature("")
+}
+
+func (p *Parser) parseFnSignature(name string) (Expression, error) {
 	args := []string{}
 	p.nextToken()
 	for p.currentToken.Type != lexer.RPAREN {
 		if p.currentToken.Type != lexer.IDENT {
-			return nil, fmt.Errorf("expected identifier in argument list")
+			return nil, fmt.Errorf("expected identifier in argument list, got '%s'", p.currentToken.Literal)
 		}
 		args = append(args, p.currentToken.Literal)
 		p.nextToken()
@@ -43,7 +58,7 @@ func (p *Parser) parseFnStatement() (Expression, error) {
 	p.nextToken()
 
 	if p.currentToken.Type != lexer.LBRACE {
-		return nil, fmt.Errorf("expected '{' to start function body")
+		return nil, fmt.Errorf("expected '{' to start function body, got '%s'", p.currentToken.Literal)
 	}
 	p.nextToken()
 
@@ -10,6 +10,7 @@ type ForStatement struct {
 	Condition Expression
 	Update    Expression
 
+	KeyName  string
 	VarName  string
 	Iterable Expression
 
@@ -69,8 +70,20 @@ func (p *Parser) parseForStatement() (Expression, error) {
 		return nil, fmt.Errorf("expected identifier in foreach-style loop")
 	}
 	varName := p.currentToken.Literal
+	keyName := ""
 	p.nextToken()
 
+	// for key, value in iterable
+	if p.currentToken.Type == lexer.COMMA {
+		p.nextToken()
+		if p.currentToken.Type != lexer.IDENT {
+			return nil, fmt.Errorf("expected identifier after ',' in foreach-style loop")
+		}
+		keyName = varName
+		varName = p.currentToken.Literal
+		p.nextToken()
+	}
+
 	if p.currentToken.Type != lexer.IN {
 		return nil, fmt.Errorf("expected 'in' after variable name in foreach-style loop")
 	}
@@ -92,6 +105,7 @@ func (p *Parser) parseForStatement() (Expression, error) {
 	}
 
 	return &ForStatement{
+		KeyName:  keyName,
 		VarName:  varName,
 		Iterable: iterable,
 		Body:     body,
@@ -48,7 +48,7 @@ func (p *Parser) parseIfStatement() (Expression, error) {
 	var elseIfParts []ElseIfClause
 	var elseBlock []Expression
 
-	for p.peekToken.Type == lexer.IDENT && p.currentToken.Literal == "else" {
+	for p.currentToken.Type == lexer.IDENT && p.currentToken.Literal == "else" {
 		p.nextToken()
 
 		if p.currentToken.Type == lexer.IDENT && p.currentToken.Literal == "if" {
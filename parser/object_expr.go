@@ -3,81 +3,82 @@ package parser
 import (
 	"fmt"
 	"github.com/isaeken/brickengine-go/lexer"
+	"strings"
+	"unicode"
 )
 
 type ObjectExpr struct {
-	Pairs map[string]Expression
+	Pairs []ObjectPair
+}
+
+// ObjectPair is one entry of an object literal. Computed keys written as
+// `[expr]: value` set KeyExpr instead of Key.
+type ObjectPair struct {
+	Key     string
+	KeyExpr Expression
+	Value   Expression
 }
 
 func (o *ObjectExpr) String() string {
-	out := "{ "
-	first := true
-	for k, v := range o.Pairs {
-		if !first {
-			out += ", "
-		}
-		first = false
-		out += fmt.Sprintf("%s: %s", k, v.String())
+	pairs := make([]string, 0, len(o.Pairs))
+	for _, pair := range o.Pairs {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.keyString(), pair.Value.String()))
+	}
+	return "{ " + strings.Join(pairs, ", ") + " }"
+}
+
+func (p ObjectPair) keyString() string {
+	if p.KeyExpr != nil {
+		return "[" + p.KeyExpr.String() + "]"
 	}
-	out += " }"
-	return out
+	if isIdentifier(p.Key) {
+		return p.Key
+	}
+	return fmt.Sprintf("%q", p.Key)
 }
 
 func (p *Parser) parseObjectExpr() (Expression, error) {
-	pairs := make(map[string]Expression)
+	var pairs []ObjectPair
+	seen := map[string]bool{}
 	p.nextToken()
 
 	for p.currentToken.Type != lexer.RBRACE && p.currentToken.Type != lexer.EOF {
-		if p.currentToken.Type != lexer.IDENT {
-			return nil, fmt.Errorf("expected identifier in object key, got '%s'", p.currentToken.Literal)
-		}
-		key := p.currentToken.Literal
-		p.nextToken()
-
-		if p.currentToken.Type != lexer.COLON {
-			return nil, fmt.Errorf("expected ':' after key '%s', got '%s'", key, p.currentToken.Literal)
-		}
-		p.nextToken()
+		var pair ObjectPair
 
-		if p.currentToken.Type == lexer.FUNC && p.currentToken.Literal == "fn" {
+		switch p.currentToken.Type {
+		case lexer.IDENT, lexer.STRING:
+			pair.Key = p.currentToken.Literal
+			if seen[pair.Key] {
+				return nil, fmt.Errorf("duplicate key '%s' in object", pair.Key)
+			}
+			seen[pair.Key] = true
 			p.nextToken()
-
-			args := []string{}
+		case lexer.LBRACKET:
 			p.nextToken()
-			for p.currentToken.Type != lexer.RPAREN {
-				if p.currentToken.Type != lexer.IDENT {
-					return nil, fmt.Errorf("expected identifier in argument list, got '%s'", p.currentToken.Literal)
-				}
-				args = append(args, p.currentToken.Literal)
-				p.nextToken()
-				if p.currentToken.Type == lexer.COMMA {
-					p.nextToken()
-				}
+			keyExpr, err := p.ParseExpression()
+			if err != nil {
+				return nil, fmt.Errorf("invalid computed object key: %w", err)
 			}
-			p.nextToken()
-
-			if p.currentToken.Type != lexer.LBRACE {
-				return nil, fmt.Errorf("expected '{' to start function body, got '%s'", p.currentToken.Literal)
+			if p.currentToken.Type != lexer.RBRACKET {
+				return nil, fmt.Errorf("expected ']' after computed object key, got '%s'", p.currentToken.Literal)
 			}
+			pair.KeyExpr = keyExpr
 			p.nextToken()
+		default:
+			return nil, fmt.Errorf("expected identifier, string or [expression] in object key, got '%s'", p.currentToken.Literal)
+		}
 
-			body, err := p.parseBlock()
-			if err != nil {
-				return nil, err
-			}
+		if p.currentToken.Type != lexer.COLON {
+			return nil, fmt.Errorf("expected ':' after key '%s', got '%s'", pair.keyString(), p.currentToken.Literal)
+		}
+		p.nextToken()
 
-			pairs[key] = &FnStatement{
-				Name: "",
-				Args: args,
-				Body: body,
-			}
-		} else {
-			expr, err := p.ParseExpression()
-			if err != nil {
-				return nil, err
-			}
-			pairs[key] = expr
+		value, err := p.ParseExpression()
+		if err != nil {
+			return nil, err
 		}
+		pair.Value = value
+		pairs = append(pairs, pair)
 
 		if p.currentToken.Type == lexer.COMMA {
 			p.nextToken()
@@ -93,3 +94,15 @@ func (p *Parser) parseObjectExpr() (Expression, error) {
 
 	return &ObjectExpr{Pairs: pairs}, nil
 }
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(unicode.IsLetter(r) || (i > 0 && (r == '_' || unicode.IsDigit(r)))) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,7 +3,9 @@ package parser
 import (
 	"fmt"
 	"github.com/isaeken/brickengine-go/lexer"
+	"github.com/isaeken/brickengine-go/units"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
@@ -50,6 +52,10 @@ func (p *Parser) parsePrimary() (Expression, error) {
 		return str, nil
 	case lexer.NUMBER:
 		num, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+		if err != nil && strings.HasSuffix(p.currentToken.Literal, "B") {
+			// size literals such as 512MB or 1GiB
+			num, err = units.ParseSize(p.currentToken.Literal)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("invalid number '%s'", p.currentToken.Literal)
 		}
@@ -79,6 +85,8 @@ func (p *Parser) parsePrimary() (Expression, error) {
 		return p.parseObjectExpr()
 	case lexer.LBRACKET:
 		return p.parseArrayLiteral()
+	case lexer.FUNC:
+		return p.parseFnLiteral()
 	default:
 		return nil, fmt.Errorf("unexpected token %s", p.currentToken.Literal)
 	}
@@ -151,9 +159,12 @@ func (p *Parser) parseStatement() (Expression, error) {
 		if p.currentToken.Literal == "if" {
 			return p.parseIfStatement()
 		}
+		if p.currentToken.Literal == "step" && p.peekToken.Type == lexer.STRING {
+			return p.parseStepStatement()
+		}
 		fallthrough
 	case lexer.FUNC:
-		if p.currentToken.Literal == "fn" {
+		if p.currentToken.Type == lexer.FUNC && p.peekToken.Type == lexer.IDENT {
 			return p.parseFnStatement()
 		}
 		fallthrough
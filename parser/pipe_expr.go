@@ -17,7 +17,7 @@ func (p *PipeExpr) String() string {
 func (p *Parser) parsePipeExpr() (Expression, error) {
 	left, err := p.parseBinaryExpr(0)
 	if err != nil {
-		return nil, fmt.Errorf("invalid left side of pipe expression: %w", err)
+		return nil, err
 	}
 
 	for p.currentToken.Type == lexer.PIPE {
@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/isaeken/brickengine-go/lexer"
+)
+
+// StepStatement is a named block such as `step "install packages" { ... }`.
+// Its statements run in the enclosing scope; the name labels log records.
+type StepStatement struct {
+	Name string
+	Body []Expression
+}
+
+func (s *StepStatement) String() string {
+	return fmt.Sprintf("step %q { ... }", s.Name)
+}
+
+func (p *Parser) parseStepStatement() (Expression, error) {
+	p.nextToken()
+	name := p.currentToken.Literal
+	p.nextToken()
+
+	if p.currentToken.Type != lexer.LBRACE {
+		return nil, fmt.Errorf("expected '{' after step name, got '%s'", p.currentToken.Literal)
+	}
+	p.nextToken()
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &StepStatement{Name: name, Body: body}, nil
+}
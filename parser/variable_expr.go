@@ -8,10 +8,31 @@ import (
 
 type VariableExpr struct {
 	Parts []string
+	// Optional[i] reports whether Parts[i] was accessed with '?.'.
+	Optional []bool
 }
 
 func (v *VariableExpr) String() string {
-	return strings.Join(v.Parts, ".")
+	if v.Optional == nil {
+		return strings.Join(v.Parts, ".")
+	}
+
+	var out strings.Builder
+	for i, part := range v.Parts {
+		if i > 0 {
+			if v.IsOptional(i) {
+				out.WriteString("?.")
+			} else {
+				out.WriteString(".")
+			}
+		}
+		out.WriteString(part)
+	}
+	return out.String()
+}
+
+func (v *VariableExpr) IsOptional(i int) bool {
+	return i < len(v.Optional) && v.Optional[i]
 }
 
 func (p *Parser) parseVariableExpr() (Expression, error) {
@@ -20,19 +41,28 @@ func (p *Parser) parseVariableExpr() (Expression, error) {
 	}
 
 	parts := []string{p.currentToken.Literal}
+	var optional []bool
 	p.nextToken()
 
-	// dot notation
-	for p.currentToken.Type == lexer.DOT {
+	// dot notation, '?.' marks the following segment as optional
+	for p.currentToken.Type == lexer.DOT || p.currentToken.Type == lexer.OPTIONAL_DOT {
+		if p.currentToken.Type == lexer.OPTIONAL_DOT {
+			for len(optional) < len(parts) {
+				optional = append(optional, false)
+			}
+			optional = append(optional, true)
+		}
+
+		sep := p.currentToken.Literal
 		p.nextToken()
 		if p.currentToken.Type != lexer.IDENT {
-			return nil, fmt.Errorf("expected identifier after '.'")
+			return nil, fmt.Errorf("expected identifier after '%s'", sep)
 		}
 		parts = append(parts, p.currentToken.Literal)
 		p.nextToken()
 	}
 
-	var expr Expression = &VariableExpr{Parts: parts}
+	var expr Expression = &VariableExpr{Parts: parts, Optional: optional}
 
 	// index access
 	for p.currentToken.Type == lexer.LBRACKET {
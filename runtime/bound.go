@@ -0,0 +1,120 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Bound is a Go value placed in the context with Bind. Scripts call its
+// exported methods like functions, e.g. `server.Restart("nginx")`, with the
+// argument conversion, error results and context injection of Functions,
+// and read its fields like those of any other Go value.
+type Bound struct {
+	value   reflect.Value
+	methods map[string]bool
+
+	// mu guards converted, the value as a script value, which is kept until
+	// a method is looked up, as calling it may change the value.
+	mu        sync.Mutex
+	converted interface{}
+	cached    bool
+}
+
+// Bind wraps v, typically a pointer to a client, for the context. Only the
+// methods named in methods may be called; calling any other method fails, so
+// Bind(v) without names exposes the fields of v but none of its methods.
+func Bind(v interface{}, methods ...string) *Bound {
+	b := &Bound{value: reflect.ValueOf(v), methods: map[string]bool{}}
+	for _, m := range methods {
+		b.methods[m] = true
+	}
+	return b
+}
+
+// Value returns the bound Go value.
+func (b *Bound) Value() interface{} {
+	if !b.value.IsValid() {
+		return nil
+	}
+	return b.value.Interface()
+}
+
+// Methods returns the names of the methods scripts may call, in the order
+// of the method set.
+func (b *Bound) Methods() []string {
+	var names []string
+	if !b.value.IsValid() {
+		return nil
+	}
+	for i := 0; i < b.value.NumMethod(); i++ {
+		name := b.value.Type().Method(i).Name
+		if b.allowed(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (b *Bound) allowed(name string) bool {
+	return b.methods[name]
+}
+
+// get returns the method or field named key. Methods outside the allowlist
+// resolve to a function failing with an error, so calls to them report why.
+func (b *Bound) get(key string) (interface{}, bool) {
+	if !b.value.IsValid() {
+		return nil, false
+	}
+	if m := b.value.MethodByName(key); m.IsValid() {
+		b.forget()
+		if !b.allowed(key) {
+			err := fmt.Errorf("method '%s' of %s is not allowed", key, b.value.Type())
+			return func(args ...interface{}) (interface{}, error) {
+				return nil, err
+			}, true
+		}
+		return m.Interface(), true
+	}
+	if obj, ok := b.fields(); ok {
+		got, found := obj.Get(key)
+		return toScriptValue(got), found
+	}
+	return nil, false
+}
+
+// fields returns the bound value converted to an object, if it is a struct.
+func (b *Bound) fields() (*Object, bool) {
+	obj, ok := b.scriptValue().(*Object)
+	return obj, ok
+}
+
+// scriptValue converts the bound value on first use and returns the cached
+// result after that.
+func (b *Bound) scriptValue() interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.cached {
+		b.converted = toScriptValue(b.Value())
+		b.cached = true
+	}
+	return b.converted
+}
+
+// forget drops the cached conversion.
+func (b *Bound) forget() {
+	b.mu.Lock()
+	b.converted, b.cached = nil, false
+	b.mu.Unlock()
+}
+
+// String formats the fields of the bound value.
+func (b *Bound) String() string {
+	return fmt.Sprint(b.scriptValue())
+}
+
+func (b *Bound) MarshalJSON() (data []byte, err error) {
+	defer recoverCycle(&err)
+	return json.Marshal(b.scriptValue())
+}
@@ -0,0 +1,516 @@
+package runtime
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// toScriptValue converts a Go value from the context or a function result to
+// the representation scripts use: numbers become float64, structs become
+// objects keyed by their `brick` tags, typed slices become arrays, maps with
+// string or numeric keys become plain maps, pointers are followed and
+// time.Time becomes Time. Values that already are script values are returned
+// as they are, without looking inside arrays and maps; their elements are
+// converted when they are reached.
+//
+// A value that refers back to itself, like a child pointing to its parent,
+// panics with a *cycleError, which the run recovers as its error.
+func toScriptValue(v interface{}) interface{} {
+	var c converter
+	out, err := c.convert(v)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// cycleError reports a Go value that cannot be converted because it refers
+// back to itself.
+type cycleError struct {
+	typ reflect.Type
+}
+
+func (e *cycleError) Error() string {
+	return fmt.Sprintf("cannot convert %s: value refers back to itself", e.typ)
+}
+
+// recoverCycle stores a *cycleError panic of toScriptValue in err and
+// re-panics anything else.
+func recoverCycle(err *error) {
+	if r := recover(); r != nil {
+		cycle, ok := r.(*cycleError)
+		if !ok {
+			panic(r)
+		}
+		*err = cycle
+	}
+}
+
+// visit identifies a pointer, map or slice on the path of a conversion.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// converter converts one value, tracking the pointers, maps and slices it is
+// inside of to detect cycles. Values shared by siblings are not cycles.
+type converter struct {
+	path map[visit]bool
+}
+
+// enter marks rv as being converted, failing if it already is.
+func (c *converter) enter(rv reflect.Value) (visit, error) {
+	key := visit{ptr: rv.Pointer(), typ: rv.Type()}
+	if rv.Kind() == reflect.Slice {
+		key.len = rv.Len()
+	}
+	if c.path[key] {
+		return key, &cycleError{typ: rv.Type()}
+	}
+	if c.path == nil {
+		c.path = map[visit]bool{}
+	}
+	c.path[key] = true
+	return key, nil
+}
+
+func (c *converter) convert(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case nil, string, bool, float64, []byte, []interface{}, map[string]interface{},
+		Context, *Object, *Bound, Time, Secret, ReturnedValue:
+		return v, nil
+	case json.Number:
+		if f, err := val.Float64(); err == nil {
+			return f, nil
+		}
+		return val.String(), nil
+	case time.Time:
+		return Time{val}, nil
+	case time.Duration:
+		return val.Seconds(), nil
+	case encoding.TextMarshaler:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return nil, nil
+		}
+		if text, err := val.MarshalText(); err == nil {
+			return string(text), nil
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Kind() == reflect.Interface {
+			return c.convert(rv.Elem().Interface())
+		}
+		key, err := c.enter(rv)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c.path, key)
+		return c.convert(rv.Elem().Interface())
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return b, nil
+		}
+		if rv.Kind() == reflect.Slice {
+			key, err := c.enter(rv)
+			if err != nil {
+				return nil, err
+			}
+			defer delete(c.path, key)
+		}
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			el, err := c.convert(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			out[i] = el
+		}
+		return out, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		key, err := c.enter(rv)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c.path, key)
+		out := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k, err := c.convert(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			el, err := c.convert(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			out[fmt.Sprint(k)] = el
+		}
+		return out, nil
+	case reflect.Struct:
+		obj := NewObject()
+		if err := c.addStructFields(obj, rv); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	}
+	return v, nil
+}
+
+// addStructFields sets the exported fields of rv on obj, flattening embedded
+// structs without a tag like encoding/json does.
+func (c *converter) addStructFields(obj *Object, rv reflect.Value) error {
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name, omitEmpty, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if field.Anonymous && name == "" {
+			if fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := c.addStructFields(obj, fv); err != nil {
+					return err
+				}
+				continue
+			}
+			name = field.Name
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		el, err := c.convert(fv.Interface())
+		if err != nil {
+			return err
+		}
+		obj.Set(name, el)
+	}
+	return nil
+}
+
+// fieldName returns the script name of a struct field from its `brick` tag,
+// e.g. `brick:"name,omitempty"`, or the field name. Anonymous struct fields
+// without a tag name return an empty name. ok is false for unexported fields
+// and fields tagged `brick:"-"`.
+func fieldName(field reflect.StructField) (name string, omitEmpty, ok bool) {
+	tag := field.Tag.Get("brick")
+	if tag == "-" || !field.IsExported() {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	omitEmpty = opts == "omitempty"
+	if name == "" && !field.Anonymous {
+		name = field.Name
+	}
+	return name, omitEmpty, true
+}
+
+// Decode stores a script value, such as the result of EvalScript, in the
+// value pointed to by out. Objects decode into structs by their `brick` tags
+// and into maps, parsing numeric keys back from strings, arrays into slices
+// and arrays, numbers into any numeric type, times and RFC 3339 strings into
+// time.Time, durations into time.Duration and strings into types
+// implementing encoding.TextUnmarshaler. Secrets decode into strings as their
+// value.
+func Decode(v interface{}, out interface{}) (err error) {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("decode: expected a non-nil pointer, got %T", out)
+	}
+	defer recoverCycle(&err)
+	return decodeValue(toScriptValue(v), rv.Elem(), "value")
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	jsonNumberType = reflect.TypeOf(json.Number(""))
+)
+
+func decodeValue(v interface{}, rv reflect.Value, path string) error {
+	if v == nil {
+		rv.SetZero()
+		return nil
+	}
+	if b, ok := v.(*Bound); ok {
+		if b.value.IsValid() && b.value.Type().AssignableTo(rv.Type()) {
+			rv.Set(b.value)
+			return nil
+		}
+		v = b.scriptValue()
+	}
+
+	switch rv.Type() {
+	case timeType:
+		t, err := toTime("decode", v)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", path, err)
+		}
+		rv.Set(reflect.ValueOf(t.Time))
+		return nil
+	case durationType:
+		d, err := toDuration("decode", v)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", path, err)
+		}
+		rv.SetInt(int64(d))
+		return nil
+	case jsonNumberType:
+		if n, ok := asNumber(v); ok {
+			rv.SetString(strconv.FormatFloat(n, 'f', -1, 64))
+			return nil
+		}
+	}
+
+	if s, isString := v.(string); isString && rv.Kind() != reflect.String && rv.Kind() != reflect.Interface {
+		if u, ok := rv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(s)); err != nil {
+				return fmt.Errorf("decode %s: %w", path, err)
+			}
+			return nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.NumMethod() == 0 {
+			rv.Set(reflect.ValueOf(plainValue(v)))
+			return nil
+		}
+		val := reflect.ValueOf(v)
+		if val.Type().AssignableTo(rv.Type()) {
+			rv.Set(val)
+			return nil
+		}
+	case reflect.Pointer:
+		elem := reflect.New(rv.Type().Elem())
+		if err := decodeValue(v, elem.Elem(), path); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+	case reflect.String:
+		switch val := v.(type) {
+		case string:
+			rv.SetString(val)
+			return nil
+		case Secret:
+			rv.SetString(val.value)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := v.(bool); ok {
+			rv.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := asNumber(v); ok {
+			if n != math.Trunc(n) || rv.OverflowInt(int64(n)) {
+				return fmt.Errorf("decode %s: %v does not fit in %s", path, n, rv.Type())
+			}
+			rv.SetInt(int64(n))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := asNumber(v); ok {
+			if n < 0 || n != math.Trunc(n) || rv.OverflowUint(uint64(n)) {
+				return fmt.Errorf("decode %s: %v does not fit in %s", path, n, rv.Type())
+			}
+			rv.SetUint(uint64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := asNumber(v); ok {
+			rv.SetFloat(n)
+			return nil
+		}
+	case reflect.Slice:
+		if b, ok := v.([]byte); ok && rv.Type().Elem().Kind() == reflect.Uint8 {
+			rv.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		if s, ok := v.(string); ok && rv.Type().Elem().Kind() == reflect.Uint8 {
+			rv.SetBytes([]byte(s))
+			return nil
+		}
+		if arr, ok := v.([]interface{}); ok {
+			out := reflect.MakeSlice(rv.Type(), len(arr), len(arr))
+			for i, el := range arr {
+				if err := decodeValue(toScriptValue(el), out.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			rv.Set(out)
+			return nil
+		}
+	case reflect.Array:
+		if arr, ok := v.([]interface{}); ok {
+			if len(arr) != rv.Len() {
+				return fmt.Errorf("decode %s: expected %d elements, got %d", path, rv.Len(), len(arr))
+			}
+			for i, el := range arr {
+				if err := decodeValue(toScriptValue(el), rv.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if obj, ok := asObject(v); ok {
+			out := reflect.MakeMapWithSize(rv.Type(), obj.Len())
+			for _, k := range obj.Keys() {
+				key := reflect.New(rv.Type().Key()).Elem()
+				if err := decodeKey(k, key, path); err != nil {
+					return err
+				}
+				el, _ := obj.Get(k)
+				val := reflect.New(rv.Type().Elem()).Elem()
+				if err := decodeValue(toScriptValue(el), val, path+"."+k); err != nil {
+					return err
+				}
+				out.SetMapIndex(key, val)
+			}
+			rv.Set(out)
+			return nil
+		}
+	case reflect.Struct:
+		if obj, ok := asObject(v); ok {
+			return decodeStruct(obj, rv, path)
+		}
+	}
+
+	return fmt.Errorf("decode %s: cannot use %s as %s", path, typeName(v), rv.Type())
+}
+
+// decodeKey stores an object key in key. Keys are strings in scripts, so
+// numeric key types parse them back, e.g. "80" for a map[int]string.
+func decodeKey(k string, key reflect.Value, path string) error {
+	var err error
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(k, 10, key.Type().Bits()); err == nil {
+			key.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		if n, err = strconv.ParseUint(k, 10, key.Type().Bits()); err == nil {
+			key.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		if n, err = strconv.ParseFloat(k, key.Type().Bits()); err == nil {
+			key.SetFloat(n)
+		}
+	default:
+		return decodeValue(k, key, path)
+	}
+	if err != nil {
+		return fmt.Errorf("decode %s: key '%s' is not a valid %s", path, k, key.Type())
+	}
+	return nil
+}
+
+// decodeStruct sets the fields of rv from obj. Keys without a matching field
+// are ignored and fields without a key are left as they are.
+func decodeStruct(obj *Object, rv reflect.Value, path string) error {
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name, _, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if field.Anonymous && name == "" {
+			if fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := decodeStruct(obj, fv, path); err != nil {
+					return err
+				}
+				continue
+			}
+			name = field.Name
+		}
+		el, found := obj.Get(name)
+		if !found {
+			continue
+		}
+		if err := decodeValue(toScriptValue(el), fv, path+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plainValue converts a script value to plain Go values for an interface{}
+// target: objects become map[string]interface{} and times time.Time.
+func plainValue(v interface{}) interface{} {
+	switch val := toScriptValue(v).(type) {
+	case *Object:
+		out := make(map[string]interface{}, val.Len())
+		for _, k := range val.Keys() {
+			el, _ := val.Get(k)
+			out[k] = plainValue(el)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, el := range val {
+			out[k] = plainValue(el)
+		}
+		return out
+	case Context:
+		return plainValue(map[string]interface{}(val))
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, el := range val {
+			out[i] = plainValue(el)
+		}
+		return out
+	case Time:
+		return val.Time
+	default:
+		return val
+	}
+}
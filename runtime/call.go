@@ -0,0 +1,202 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// callFunction invokes a Go function or a script function value with
+// evaluated script arguments. Arguments are converted to the parameter types
+// of fn, extra arguments are dropped for non-variadic functions, a trailing
+// error result is returned as an error and panics are recovered as errors.
+// Functions whose first parameter is a context.Context receive ctx there.
+func callFunction(ctx context.Context, name string, fn interface{}, args []interface{}) (result interface{}, err error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return nil, fmt.Errorf("'%s' is not callable", name)
+	}
+
+	ft := fv.Type()
+	skip := 0
+	if ft.NumIn() > 0 && ft.In(0) == contextType {
+		skip = 1
+	}
+
+	in, err := convertArgs(name, ft, skip, args)
+	if err != nil {
+		return nil, err
+	}
+	if skip == 1 {
+		in = append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, in...)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%s: %v", name, r)
+			}
+		}
+	}()
+
+	result, err = unpackResults(fv.Call(in))
+	return toScriptValue(result), err
+}
+
+// convertArgs converts args to the parameters of ft, ignoring the first skip
+// parameters.
+func convertArgs(name string, ft reflect.Type, skip int, args []interface{}) ([]reflect.Value, error) {
+	fixed := ft.NumIn() - skip
+	if ft.IsVariadic() {
+		fixed--
+	} else if len(args) > fixed {
+		args = args[:fixed]
+	}
+
+	if len(args) < fixed {
+		return nil, fmt.Errorf("%s: expected %d arguments, got %d", name, fixed, len(args))
+	}
+
+	in := make([]reflect.Value, 0, len(args))
+	for i, arg := range args {
+		var t reflect.Type
+		if i < fixed {
+			t = ft.In(skip + i)
+		} else {
+			t = ft.In(skip + fixed).Elem()
+		}
+
+		v, err := convertValue(arg, t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %w", name, i+1, err)
+		}
+		in = append(in, v)
+	}
+	return in, nil
+}
+
+// convertValue converts a script value to t, handling the numeric, array and
+// object representations scripts use.
+func convertValue(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+
+	if t.Kind() == reflect.Map {
+		v = plainObjects(v)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if isNumberKind(rv.Kind()) {
+			return rv.Convert(t), nil
+		}
+	case reflect.Slice:
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			out := reflect.MakeSlice(t, rv.Len(), rv.Len())
+			for i := 0; i < rv.Len(); i++ {
+				el, err := convertValue(rv.Index(i).Interface(), t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+				}
+				out.Index(i).Set(el)
+			}
+			return out, nil
+		}
+	case reflect.Map:
+		if rv.Kind() == reflect.Map {
+			out := reflect.MakeMapWithSize(t, rv.Len())
+			iter := rv.MapRange()
+			for iter.Next() {
+				key, err := convertValue(iter.Key().Interface(), t.Key())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				el, err := convertValue(iter.Value().Interface(), t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key '%v': %w", iter.Key().Interface(), err)
+				}
+				out.SetMapIndex(key, el)
+			}
+			return out, nil
+		}
+	}
+
+	if rv.Kind() == t.Kind() && rv.Type().ConvertibleTo(t) {
+		return rv.Convert(t), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", typeName(v), t)
+}
+
+func unpackResults(out []reflect.Value) (interface{}, error) {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if !out[n-1].IsNil() {
+			return nil, out[n-1].Interface().(error)
+		}
+		out = out[:n-1]
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// typeName describes a value using script type names.
+func typeName(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	switch v.(type) {
+	case *Object, *Bound:
+		return "object"
+	case Time, time.Time:
+		return "time"
+	case Secret:
+		return "secret"
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map:
+		return "object"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Func:
+		return "function"
+	default:
+		if isNumberKind(reflect.TypeOf(v).Kind()) {
+			return "number"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
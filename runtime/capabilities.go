@@ -0,0 +1,182 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Capability names a kind of access a function needs beyond pure
+// computation on its arguments.
+type Capability string
+
+const (
+	CapNet     Capability = "net"
+	CapFSRead  Capability = "fs.read"
+	CapFSWrite Capability = "fs.write"
+	CapExec    Capability = "exec"
+	CapEnv     Capability = "env"
+	CapTime    Capability = "time"
+	CapRandom  Capability = "random"
+)
+
+// AllCapabilities lists every capability known to the built-in modules.
+var AllCapabilities = []Capability{CapNet, CapFSRead, CapFSWrite, CapExec, CapEnv, CapTime, CapRandom}
+
+// Module is a named group of functions and the capabilities all of them
+// need. Modules without requirements are always available.
+type Module struct {
+	Name      string
+	Requires  []Capability
+	Functions Functions
+}
+
+// CapabilityError is returned when a script calls a function whose module
+// requires a capability the engine was not granted.
+type CapabilityError struct {
+	Function   string
+	Capability Capability
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("capability denied: %s requires '%s'", e.Function, e.Capability)
+}
+
+// DefaultModules returns the built-in modules. Functions reading the clock or
+// drawing random values are split into the "clock" and "random" modules so
+// the remaining ones stay pure.
+func DefaultModules() []Module {
+	ids := UUIDAndFormatFunctions()
+	strs := StringFunctions()
+	times := TimeFunctions()
+	nets := NetFunctions()
+
+	random := takeFunctions(ids, "uuid", "random")
+	random = mergeFunctions(random, takeFunctions(strs, "random_str"), takeFunctions(nets, "random_ipv4_in", "random_mac"), RandomFunctions())
+
+	return []Module{
+		{Name: "format", Functions: mergeFunctions(ids, FormatFunctions())},
+		{Name: "string", Functions: strs},
+		{Name: "math", Functions: MathFunctions()},
+		{Name: "type", Functions: TypeFunctions()},
+		{Name: "array", Functions: ArrayFunctions()},
+		{Name: "object", Functions: ObjectFunctions()},
+		{Name: "time", Functions: times},
+		{Name: "clock", Requires: []Capability{CapTime}, Functions: takeFunctions(times, "now", "time.now")},
+		{Name: "random", Requires: []Capability{CapRandom}, Functions: random},
+		{Name: "network", Functions: nets},
+		{Name: "unit", Functions: UnitFunctions()},
+		{Name: "regex", Functions: RegexFunctions()},
+		{Name: "encoding", Functions: EncodingFunctions()},
+		{Name: "util", Functions: UtilFunctions()},
+		{Name: "template", Functions: TemplateFunctions()},
+		{Name: "fs", Requires: []Capability{CapFSRead}, Functions: FSReadFunctions()},
+		{Name: "fs.write", Requires: []Capability{CapFSWrite}, Functions: FSWriteFunctions()},
+		{Name: "http", Requires: []Capability{CapNet}, Functions: HttpFunctions()},
+		{Name: "exec", Requires: []Capability{CapExec}, Functions: ExecFunctions()},
+		{Name: "env", Requires: []Capability{CapEnv}, Functions: EnvFunctions()},
+		{Name: "log", Functions: LogFunctions()},
+	}
+}
+
+// takeFunctions removes the named functions from fns and returns them as a
+// new group.
+func takeFunctions(fns Functions, names ...string) Functions {
+	taken := Functions{}
+	for _, name := range names {
+		if fn, ok := fns[name]; ok {
+			taken[name] = fn
+			delete(fns, name)
+		}
+	}
+	return taken
+}
+
+// Engine runs scripts and templates with the functions of a set of modules,
+// limited to an explicit grant of capabilities. It is the safe way to run
+// untrusted templates: functions of modules whose requirements are not
+// granted fail with a CapabilityError when called.
+type Engine struct {
+	grants map[Capability]bool
+	funcs  Functions
+}
+
+// NewEngine returns an engine with the default modules and extra, granting
+// only the given capabilities.
+func NewEngine(grants []Capability, extra ...Module) *Engine {
+	e := &Engine{grants: map[Capability]bool{}, funcs: Functions{}}
+	for _, c := range grants {
+		e.grants[c] = true
+	}
+	for _, m := range append(DefaultModules(), extra...) {
+		e.Register(m)
+	}
+	return e
+}
+
+// Register adds the functions of m, replacing functions of the same name.
+// If m requires a capability that was not granted, its functions are
+// registered as stubs that return a CapabilityError.
+func (e *Engine) Register(m Module) {
+	var denied Capability
+	for _, c := range m.Requires {
+		if !e.grants[c] {
+			denied = c
+			break
+		}
+	}
+
+	for name, fn := range m.Functions {
+		if denied == "" {
+			e.funcs[name] = fn
+			continue
+		}
+		err := &CapabilityError{Function: name, Capability: denied}
+		e.funcs[name] = func(args ...interface{}) (interface{}, error) {
+			return nil, err
+		}
+	}
+}
+
+// Granted reports whether the engine was granted c.
+func (e *Engine) Granted(c Capability) bool {
+	return e.grants[c]
+}
+
+// Grants returns the granted capabilities in sorted order.
+func (e *Engine) Grants() []Capability {
+	grants := make([]Capability, 0, len(e.grants))
+	for c := range e.grants {
+		grants = append(grants, c)
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i] < grants[j] })
+	return grants
+}
+
+// Functions returns a copy of the engine's functions, for use with
+// RunScript, RunTemplate and RenderTree.
+func (e *Engine) Functions() Functions {
+	return mergeFunctions(e.funcs)
+}
+
+// RunScript runs a script with a copy of the engine's functions, so the
+// functions a script declares do not outlive its run.
+func (e *Engine) RunScript(code string, ctx Context, opts ...Options) (string, error) {
+	return RunScript(code, ctx, e.Functions(), opts...)
+}
+
+// RunScriptContext runs a script with the engine's functions until parent is
+// canceled.
+func (e *Engine) RunScriptContext(parent context.Context, code string, ctx Context, opts ...Options) (string, error) {
+	return RunScriptContext(parent, code, ctx, e.Functions(), opts...)
+}
+
+// EvalScript runs a script with the engine's functions and returns its value.
+func (e *Engine) EvalScript(code string, ctx Context, opts ...Options) (interface{}, error) {
+	return EvalScript(code, ctx, e.Functions(), opts...)
+}
+
+// RunTemplate renders a template with the engine's functions.
+func (e *Engine) RunTemplate(code string, ctx Context, opts ...Options) (string, error) {
+	return RunTemplate(code, ctx, e.Functions(), opts...)
+}
@@ -0,0 +1,142 @@
+package runtime
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"hash"
+	"hash/crc32"
+	"net/url"
+	"strings"
+)
+
+// MaxBcryptCost bounds the cost scripts may pass to bcrypt_hash. Every step
+// doubles the hashing time, and cost 31 runs for days.
+var MaxBcryptCost = 14
+
+func EncodingFunctions() Functions {
+	return Functions{
+		"base64_encode": func(v interface{}) (string, error) {
+			return encodeBytes("base64_encode", v, base64.StdEncoding.EncodeToString)
+		},
+		"base64_decode": func(s string) (string, error) {
+			return decodeBase64("base64_decode", s, base64.StdEncoding, base64.RawStdEncoding)
+		},
+		"base64url_encode": func(v interface{}) (string, error) {
+			return encodeBytes("base64url_encode", v, base64.URLEncoding.EncodeToString)
+		},
+		"base64url_decode": func(s string) (string, error) {
+			return decodeBase64("base64url_decode", s, base64.URLEncoding, base64.RawURLEncoding)
+		},
+		"hex_encode": func(v interface{}) (string, error) {
+			return encodeBytes("hex_encode", v, hex.EncodeToString)
+		},
+		"hex_decode": func(s string) (string, error) {
+			data, err := hex.DecodeString(strings.TrimSpace(s))
+			if err != nil {
+				return "", fmt.Errorf("hex_decode: %w", err)
+			}
+			return string(data), nil
+		},
+		"url_encode": url.QueryEscape,
+		"url_decode": func(s string) (string, error) {
+			decoded, err := url.QueryUnescape(s)
+			if err != nil {
+				return "", fmt.Errorf("url_decode: %w", err)
+			}
+			return decoded, nil
+		},
+		"md5": func(v interface{}) (string, error) {
+			return hashHex("md5", v, md5.New)
+		},
+		"sha1": func(v interface{}) (string, error) {
+			return hashHex("sha1", v, sha1.New)
+		},
+		"sha256": func(v interface{}) (string, error) {
+			return hashHex("sha256", v, sha256.New)
+		},
+		"sha512": func(v interface{}) (string, error) {
+			return hashHex("sha512", v, sha512.New)
+		},
+		"hmac_sha256": func(key, msg interface{}) (string, error) {
+			k, err := toBytes("hmac_sha256", key)
+			if err != nil {
+				return "", err
+			}
+			return hashHex("hmac_sha256", msg, func() hash.Hash { return hmac.New(sha256.New, k) })
+		},
+		"crc32": func(v interface{}) (float64, error) {
+			data, err := toBytes("crc32", v)
+			if err != nil {
+				return 0, err
+			}
+			return float64(crc32.ChecksumIEEE(data)), nil
+		},
+		"bcrypt_hash": func(password string, cost ...float64) (string, error) {
+			c := bcrypt.DefaultCost
+			if len(cost) > 0 {
+				c = int(cost[0])
+			}
+			if c > MaxBcryptCost {
+				return "", fmt.Errorf("bcrypt_hash: cost %d is above the limit of %d", c, MaxBcryptCost)
+			}
+			hashed, err := bcrypt.GenerateFromPassword([]byte(password), c)
+			if err != nil {
+				return "", fmt.Errorf("bcrypt_hash: %w", err)
+			}
+			return string(hashed), nil
+		},
+		"bcrypt_verify": func(hashed, password string) bool {
+			return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+		},
+	}
+}
+
+// toBytes accepts strings and byte values such as those returned by
+// secure_random_bytes or passed in by the host.
+func toBytes(name string, v interface{}) ([]byte, error) {
+	switch val := v.(type) {
+	case string:
+		return []byte(val), nil
+	case []byte:
+		return val, nil
+	default:
+		return nil, fmt.Errorf("%s: expected string or bytes, got %s", name, typeName(v))
+	}
+}
+
+func encodeBytes(name string, v interface{}, encode func([]byte) string) (string, error) {
+	data, err := toBytes(name, v)
+	if err != nil {
+		return "", err
+	}
+	return encode(data), nil
+}
+
+// decodeBase64 decodes s with padding, falling back to the unpadded variant.
+func decodeBase64(name, s string, padded, raw *base64.Encoding) (string, error) {
+	s = strings.TrimSpace(s)
+	data, err := padded.DecodeString(s)
+	if err != nil {
+		if data, err = raw.DecodeString(s); err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return string(data), nil
+}
+
+func hashHex(name string, v interface{}, newHash func() hash.Hash) (string, error) {
+	data, err := toBytes(name, v)
+	if err != nil {
+		return "", err
+	}
+	h := newHash()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
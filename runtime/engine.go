@@ -1,47 +1,185 @@
 package runtime
 
 import (
+	"context"
 	"fmt"
 	"github.com/isaeken/brickengine-go/lexer"
 	"github.com/isaeken/brickengine-go/parser"
+	"io"
 	"regexp"
 	"strings"
 )
 
+var MaxOutputBytes = 10 * 1024 * 1024
+
 var exprRegex = regexp.MustCompile(`\{\{\s*(.*?)\s*\}\}`)
 
-func EvalTemplate(input string, ctx Context, funcs Functions) (string, error) {
-	matches := exprRegex.FindAllStringSubmatchIndex(input, -1)
-	if len(matches) == 0 {
-		return input, nil
+// delimRegex returns the expression scanner for the given delimiters.
+func delimRegex(left, right string) *regexp.Regexp {
+	if left == "{{" && right == "}}" {
+		return exprRegex
 	}
+	return regexp.MustCompile(regexp.QuoteMeta(left) + `\s*(.*?)\s*` + regexp.QuoteMeta(right))
+}
 
-	var result strings.Builder
+// Template is a parsed template that can be rendered multiple times.
+type Template struct {
+	segments   []templateSegment
+	inputs     []TemplateInput
+	options    Options
+	leftDelim  string
+	rightDelim string
+}
+
+// templateSegment is either literal text or an expression to evaluate.
+type templateSegment struct {
+	text   string
+	source string
+	expr   parser.Expression
+}
+
+func ParseTemplate(input string, opts ...Options) (*Template, error) {
+	inputs, input, err := splitFrontMatter(input)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{inputs: inputs, options: resolveOptions(opts)}
+	t.leftDelim, t.rightDelim = t.options.delims()
 	last := 0
 
-	for _, match := range matches {
+	for _, match := range delimRegex(t.leftDelim, t.rightDelim).FindAllStringSubmatchIndex(input, -1) {
 		fullStart, fullEnd := match[0], match[1]
 		exprStart, exprEnd := match[2], match[3]
 		exprText := input[exprStart:exprEnd]
 
-		result.WriteString(input[last:fullStart])
+		if fullStart > last {
+			t.segments = append(t.segments, templateSegment{text: input[last:fullStart]})
+		}
 
 		l := lexer.New(exprText)
 		p := parser.New(l)
 		expr, err := p.ParseExpression()
 		if err != nil {
-			return "", fmt.Errorf("parse error in '{{ %s }}': %w", exprText, err)
+			return nil, fmt.Errorf("parse error in '%s': %w", t.tag(exprText), err)
 		}
 
-		val, err := Evaluate(expr, ctx, funcs)
-		if err != nil {
-			return "", fmt.Errorf("evaluation error in '{{ %s }}': %w", exprText, err)
+		t.segments = append(t.segments, templateSegment{source: exprText, expr: expr})
+		last = fullEnd
+	}
+
+	if last < len(input) {
+		t.segments = append(t.segments, templateSegment{text: input[last:]})
+	}
+
+	return t, nil
+}
+
+// Inputs returns the inputs declared in the template's front matter.
+func (t *Template) Inputs() []TemplateInput {
+	return t.inputs
+}
+
+// Execute renders the template into w as each segment is evaluated. Declared
+// inputs are validated and defaulted before anything is written. Rendering
+// stops at the first evaluation or write error, or once the output exceeds the
+// configured size limit.
+func (t *Template) Execute(w io.Writer, ctx Context, funcs Functions) (err error) {
+	defer recoverCycle(&err)
+	ctx, err = applyInputs(t.inputs, ctx)
+	if err != nil {
+		return err
+	}
+
+	evaluator := NewEvaluator(t.options)
+	out := &limitedWriter{w: w, limit: t.options.maxOutputBytes()}
+
+	for _, seg := range t.segments {
+		text := seg.text
+		if seg.expr != nil {
+			val, err := evaluator.Evaluate(seg.expr, ctx, funcs)
+			if err != nil {
+				return fmt.Errorf("evaluation error in '%s': %w", t.tag(seg.source), err)
+			}
+			text = formatTemplateValue(val)
 		}
 
-		result.WriteString(fmt.Sprint(val))
-		last = fullEnd
+		if _, err := io.WriteString(out, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tag formats an expression with the template's delimiters for error messages.
+func (t *Template) tag(source string) string {
+	return t.leftDelim + " " + source + " " + t.rightDelim
+}
+
+func EvalTemplate(input string, ctx Context, funcs Functions, opts ...Options) (string, error) {
+	t, err := ParseTemplate(input, opts...)
+	if err != nil {
+		return "", err
 	}
 
-	result.WriteString(input[last:])
+	var result strings.Builder
+	if err := t.Execute(&result, ctx, funcs); err != nil {
+		return "", err
+	}
 	return result.String(), nil
 }
+
+// TemplateFunctions render templates from scripts with the functions and
+// options of the current run.
+func TemplateFunctions() Functions {
+	return Functions{
+		"render": func(ctx context.Context, template string, vars ...interface{}) (string, error) {
+			c := Context{}
+			if len(vars) > 0 && vars[0] != nil {
+				o, err := objectArg("render", vars[0])
+				if err != nil {
+					return "", err
+				}
+				c = Context(o.ToMap())
+			}
+			out, err := EvalTemplate(template, c, stateFrom(ctx).funcs, OptionsFrom(ctx))
+			if err != nil {
+				return "", fmt.Errorf("render: %w", err)
+			}
+			return out, nil
+		},
+	}
+}
+
+// formatTemplateValue renders an evaluated expression into template output.
+// Null values render as an empty string rather than "<nil>".
+func formatTemplateValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case Secret:
+		return v.value
+	}
+	return fmt.Sprint(val)
+}
+
+// limitedWriter fails once more than limit bytes have been written.
+type limitedWriter struct {
+	w       io.Writer
+	limit   int
+	written int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.written+len(p) > l.limit {
+		return 0, fmt.Errorf("output size limit exceeded (%d bytes)", l.limit)
+	}
+
+	n, err := l.w.Write(p)
+	l.written += n
+	if err != nil {
+		return n, fmt.Errorf("write error: %w", err)
+	}
+	return n, nil
+}
@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"context"
 	"fmt"
 	"github.com/isaeken/brickengine-go/parser"
 	"reflect"
@@ -11,13 +12,70 @@ import (
 var LoopLimit = 100_000_000
 var MaxMemoryBytes = 10 * 1024 * 1024
 
+// MaxRangeLength bounds the number of elements a single range() call returns.
+var MaxRangeLength = 1_000_000
+
 type Context map[string]interface{}
 
 type Functions map[string]interface{}
 
 type FunctionMap map[string]*parser.FnStatement
 
+// Evaluator evaluates parsed expressions using the options of a single run.
+type Evaluator struct {
+	Options Options
+
+	ctx   context.Context
+	state *runState
+}
+
+func NewEvaluator(opts Options) *Evaluator {
+	return NewEvaluatorContext(context.Background(), opts)
+}
+
+// NewEvaluatorContext returns an evaluator whose run stops once parent is
+// canceled. Go functions taking a context receive one derived from parent.
+func NewEvaluatorContext(parent context.Context, opts Options) *Evaluator {
+	e := &Evaluator{Options: opts}
+	e.ctx, e.state = newRunContext(parent, opts)
+	return e
+}
+
+// runContext returns the context passed to Go functions that accept one.
+func (e *Evaluator) runContext() context.Context {
+	if e.ctx == nil {
+		e.ctx, e.state = newRunContext(context.Background(), e.Options)
+	}
+	return e.ctx
+}
+
+// step counts one evaluation step against Options.MaxSteps and stops the
+// run once its context is canceled.
+func (e *Evaluator) step() error {
+	ctx := e.runContext()
+	if done := ctx.Done(); done != nil {
+		select {
+		case <-done:
+			return ctx.Err()
+		default:
+		}
+	}
+	return e.state.charge(1)
+}
+
 func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}, error) {
+	return NewEvaluator(Options{}).Evaluate(expr, ctx, funcs)
+}
+
+func DeclareFunction(ctx Context, funcs Functions, Args []string, Body []parser.Expression) interface{} {
+	return NewEvaluator(Options{}).DeclareFunction(ctx, funcs, Args, Body)
+}
+
+func (e *Evaluator) Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+
 	switch node := expr.(type) {
 	case *parser.StringLiteral:
 		return node.Value, nil
@@ -30,7 +88,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 	case *parser.ArrayLiteral:
 		var values []interface{}
 		for _, el := range node.Elements {
-			v, err := Evaluate(el, ctx, funcs)
+			v, err := e.Evaluate(el, ctx, funcs)
 			if err != nil {
 				return nil, err
 			}
@@ -38,102 +96,118 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 		}
 		return values, nil
 	case *parser.VariableExpr:
-		return ResolveVariable(ctx, node.Parts)
+		if _, found := lookupVariable(ctx, node.Parts); !found {
+			if fn, ok := funcs[strings.Join(node.Parts, ".")]; ok {
+				return fn, nil
+			}
+		}
+		return resolveVariable(ctx, node, e.Options.Strict)
 	case *parser.BinaryExpr:
-		left, err := Evaluate(node.Left, ctx, funcs)
+		left, err := e.Evaluate(node.Left, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
 
-		right, err := Evaluate(node.Right, ctx, funcs)
+		right, err := e.Evaluate(node.Right, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
 
 		return EvalBinary(left, right, node.Operator)
 	case *parser.CallExpr:
+		name := node.Target.String()
+		fn, found := interface{}(nil), false
 		if varExpr, ok := node.Target.(*parser.VariableExpr); ok {
 			fnName := strings.Join(varExpr.Parts, ".")
 
-			if fn, ok := funcs[fnName]; ok {
-				args := []reflect.Value{}
-				for _, arg := range node.Args {
-					val, err := Evaluate(arg, ctx, funcs)
-					if err != nil {
-						return nil, err
-					}
-					args = append(args, reflect.ValueOf(val))
-				}
-				results := reflect.ValueOf(fn).Call(args)
-				return results[0].Interface(), nil
+			fn, found = funcs[fnName]
+			if !found && fnName == "exists" {
+				return e.evalExists(node.Args, ctx, funcs)
 			}
 		}
 
-		targetVal, err := Evaluate(node.Target, ctx, funcs)
-		if err != nil {
-			return nil, err
-		}
-
-		fn := reflect.ValueOf(targetVal)
-		if fn.Kind() != reflect.Func {
-			return nil, fmt.Errorf("expression is not callable")
+		if !found {
+			targetVal, err := e.Evaluate(node.Target, ctx, funcs)
+			if err != nil {
+				return nil, err
+			}
+			if reflect.ValueOf(targetVal).Kind() != reflect.Func {
+				return nil, fmt.Errorf("expression is not callable")
+			}
+			fn = targetVal
 		}
 
-		args := []reflect.Value{}
+		args := make([]interface{}, 0, len(node.Args))
 		for _, arg := range node.Args {
-			val, err := Evaluate(arg, ctx, funcs)
+			val, err := e.Evaluate(arg, ctx, funcs)
 			if err != nil {
 				return nil, err
 			}
-			args = append(args, reflect.ValueOf(val))
+			args = append(args, val)
 		}
 
-		results := fn.Call(args)
-		return results[0].Interface(), nil
+		runCtx := e.runContext()
+		e.state.funcs = funcs
+		e.state.line = node.Line
+		return callFunction(runCtx, name, fn, args)
 	case *parser.PipeExpr:
-		leftVal, err := Evaluate(node.Left, ctx, funcs)
+		leftVal, err := e.Evaluate(node.Left, ctx, funcs)
 		if err != nil {
-			return Evaluate(node.Right, ctx, funcs)
+			return e.Evaluate(node.Right, ctx, funcs)
 		}
 
 		if IsTruthy(leftVal) {
 			return leftVal, nil
 		}
 
-		return Evaluate(node.Right, ctx, funcs)
+		return e.Evaluate(node.Right, ctx, funcs)
 	case *parser.IndexExpr:
-		target, err := Evaluate(node.Target, ctx, funcs)
+		target, err := e.Evaluate(node.Target, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
-		index, err := Evaluate(node.Index, ctx, funcs)
+		index, err := e.Evaluate(node.Index, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
+		if key, isString := index.(string); isString {
+			val, found, isObject := objectGet(target, key)
+			if !isObject {
+				return nil, fmt.Errorf("cannot access '%s' in non-object (%T)", key, target)
+			}
+			if !found && e.Options.Strict {
+				return nil, &UndefinedError{Path: node.String()}
+			}
+			return val, nil
+		}
 		arr := reflect.ValueOf(target)
-		i := int(reflect.ValueOf(index).Float())
-		if arr.Kind() == reflect.Slice && i >= 0 && i < arr.Len() {
-			return arr.Index(i).Interface(), nil
+		n, isNumber := asNumber(index)
+		i := int(n)
+		if isNumber && arr.Kind() == reflect.Slice && i >= 0 && i < arr.Len() {
+			return toScriptValue(arr.Index(i).Interface()), nil
 		}
 		return nil, fmt.Errorf("index out of range")
 	case *parser.ObjectExpr:
-		obj := make(map[string]interface{})
-		for k, v := range node.Pairs {
-			switch fn := v.(type) {
-			case *parser.FnStatement:
-				fnValue := DeclareFunction(ctx, funcs, fn.Args, fn.Body)
-				obj[k] = fnValue
-			default:
-				val, err := Evaluate(fn, ctx, funcs)
+		obj := NewObject()
+		for _, pair := range node.Pairs {
+			key := pair.Key
+			if pair.KeyExpr != nil {
+				k, err := e.Evaluate(pair.KeyExpr, ctx, funcs)
 				if err != nil {
 					return nil, err
 				}
-				obj[k] = val
+				key = keyString(k)
 			}
+
+			val, err := e.Evaluate(pair.Value, ctx, funcs)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key, val)
 		}
 		return obj, nil
 	case *parser.AssignmentStmt:
-		val, err := Evaluate(node.Value, ctx, funcs)
+		val, err := e.Evaluate(node.Value, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
@@ -143,13 +217,13 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 		}
 		return val, nil
 	case *parser.IfStatement:
-		condVal, err := Evaluate(node.Condition, ctx, funcs)
+		condVal, err := e.Evaluate(node.Condition, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
 		if ToBool(condVal) {
 			for _, stmt := range node.ThenBlock {
-				val, err := Evaluate(stmt, ctx, funcs)
+				val, err := e.Evaluate(stmt, ctx, funcs)
 				if err != nil {
 					return nil, err
 				}
@@ -160,13 +234,13 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 			return nil, nil
 		}
 		for _, elseif := range node.ElseIfParts {
-			condVal, err := Evaluate(elseif.Condition, ctx, funcs)
+			condVal, err := e.Evaluate(elseif.Condition, ctx, funcs)
 			if err != nil {
 				return nil, err
 			}
 			if ToBool(condVal) {
 				for _, stmt := range elseif.Block {
-					val, err := Evaluate(stmt, ctx, funcs)
+					val, err := e.Evaluate(stmt, ctx, funcs)
 					if err != nil {
 						return nil, err
 					}
@@ -178,7 +252,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 			}
 		}
 		for _, stmt := range node.ElseBlock {
-			val, err := Evaluate(stmt, ctx, funcs)
+			val, err := e.Evaluate(stmt, ctx, funcs)
 			if err != nil {
 				return nil, err
 			}
@@ -188,41 +262,51 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 		}
 		return nil, nil
 	case *parser.ReturnStatement:
-		val, err := Evaluate(node.Value, ctx, funcs)
+		val, err := e.Evaluate(node.Value, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
 		return ReturnedValue{Value: val}, nil
 	case *parser.LetStatement:
-		val, err := Evaluate(node.Value, ctx, funcs)
+		val, err := e.Evaluate(node.Value, ctx, funcs)
 		if err != nil {
 			return "", err
 		}
 		ctx[node.Name] = val
 		return val, nil
 	case *parser.FnStatement:
-		funcs[node.Name] = DeclareFunction(ctx, funcs, node.Args, node.Body)
+		if node.Name == "" {
+			return e.DeclareFunction(ctx, funcs, node.Args, node.Body), nil
+		}
+		funcs[node.Name] = e.DeclareFunction(ctx, funcs, node.Args, node.Body)
 
 		return nil, nil
 	case *parser.ForStatement:
 		count := 0
 
 		if node.Iterable != nil {
-			iterVal, err := Evaluate(node.Iterable, ctx, funcs)
+			iterVal, err := e.Evaluate(node.Iterable, ctx, funcs)
 			if err != nil {
 				return nil, err
 			}
 
-			slice, ok := iterVal.([]interface{})
-			if !ok {
-				return nil, fmt.Errorf("foreach loop target must be an array")
+			keys, items, err := iterationPairs(iterVal)
+			if err != nil {
+				return nil, err
 			}
 
-			for _, item := range slice {
-				ctx[node.VarName] = item
+			for i, item := range items {
+				if node.KeyName != "" {
+					ctx[node.KeyName] = keys[i]
+					ctx[node.VarName] = item
+				} else if _, _, isObject := objectGet(iterVal, ""); isObject {
+					ctx[node.VarName] = keys[i]
+				} else {
+					ctx[node.VarName] = item
+				}
 
 				for _, stmt := range node.Body {
-					val, err := Evaluate(stmt, ctx, funcs)
+					val, err := e.Evaluate(stmt, ctx, funcs)
 					if err != nil {
 						return nil, err
 					}
@@ -234,7 +318,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 			return nil, nil
 		}
 
-		_, err := Evaluate(node.Init, ctx, funcs)
+		_, err := e.Evaluate(node.Init, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
@@ -247,7 +331,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 				return nil, err
 			}
 
-			condVal, err := Evaluate(node.Condition, ctx, funcs)
+			condVal, err := e.Evaluate(node.Condition, ctx, funcs)
 			if err != nil {
 				return nil, err
 			}
@@ -256,7 +340,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 			}
 
 			for _, stmt := range node.Body {
-				val, err := Evaluate(stmt, ctx, funcs)
+				val, err := e.Evaluate(stmt, ctx, funcs)
 				if err != nil {
 					return nil, err
 				}
@@ -265,7 +349,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 				}
 			}
 
-			_, err = Evaluate(node.Update, ctx, funcs)
+			_, err = e.Evaluate(node.Update, ctx, funcs)
 			if err != nil {
 				return nil, err
 			}
@@ -285,7 +369,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 				}
 			}
 
-			condVal, err := Evaluate(node.Condition, ctx, funcs)
+			condVal, err := e.Evaluate(node.Condition, ctx, funcs)
 			if err != nil {
 				return nil, err
 			}
@@ -294,7 +378,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 			}
 
 			for _, stmt := range node.Body {
-				val, err := Evaluate(stmt, ctx, funcs)
+				val, err := e.Evaluate(stmt, ctx, funcs)
 				if err != nil {
 					return nil, err
 				}
@@ -304,12 +388,27 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 			}
 		}
 		return nil, nil
+	case *parser.StepStatement:
+		e.runContext()
+		outer := e.state.step
+		defer func() { e.state.step = outer }()
+		e.state.step = node.Name
+		for _, stmt := range node.Body {
+			val, err := e.Evaluate(stmt, ctx, funcs)
+			if err != nil {
+				return nil, fmt.Errorf("step '%s': %w", node.Name, err)
+			}
+			if IsReturn(val) {
+				return val, nil
+			}
+		}
+		return nil, nil
 	case *parser.TryCatchStatement:
 		for _, stmt := range node.TryBlock {
-			val, err := Evaluate(stmt, ctx, funcs)
+			val, err := e.Evaluate(stmt, ctx, funcs)
 			if err != nil {
 				for _, catchStmt := range node.CatchBlock {
-					catchVal, cerr := Evaluate(catchStmt, ctx, funcs)
+					catchVal, cerr := e.Evaluate(catchStmt, ctx, funcs)
 					if cerr != nil {
 						return nil, cerr
 					}
@@ -317,7 +416,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 						return catchVal, nil
 					}
 				}
-				return nil, err
+				return nil, nil
 			}
 			if IsReturn(val) {
 				return val, nil
@@ -325,27 +424,35 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 		}
 		return nil, nil
 	case *parser.IndexAssignmentStatement:
-		target, err := Evaluate(node.Target, ctx, funcs)
+		target, err := e.Evaluate(node.Target, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
 
-		index, err := Evaluate(node.Index, ctx, funcs)
+		index, err := e.Evaluate(node.Index, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
 
-		value, err := Evaluate(node.Value, ctx, funcs)
+		value, err := e.Evaluate(node.Value, ctx, funcs)
 		if err != nil {
 			return nil, err
 		}
 
+		if key, isString := index.(string); isString {
+			if !setObjectKey(target, key, value) {
+				return nil, fmt.Errorf("assignment target must be an object")
+			}
+			return value, nil
+		}
+
 		slice, ok := target.([]interface{})
 		if !ok {
 			return nil, fmt.Errorf("assignment target must be an array")
 		}
 
-		i := int(reflect.ValueOf(index).Float())
+		n, _ := asNumber(index)
+		i := int(n)
 		if i < 0 {
 			return nil, fmt.Errorf("negative index not allowed")
 		}
@@ -368,7 +475,7 @@ func Evaluate(expr parser.Expression, ctx Context, funcs Functions) (interface{}
 	}
 }
 
-func DeclareFunction(ctx Context, funcs Functions, Args []string, Body []parser.Expression) interface{} {
+func (e *Evaluator) DeclareFunction(ctx Context, funcs Functions, Args []string, Body []parser.Expression) interface{} {
 	return func(args ...interface{}) interface{} {
 		localCtx := make(Context)
 		for k, v := range ctx {
@@ -381,7 +488,7 @@ func DeclareFunction(ctx Context, funcs Functions, Args []string, Body []parser.
 		}
 
 		for _, stmt := range Body {
-			val, err := Evaluate(stmt, localCtx, funcs)
+			val, err := e.Evaluate(stmt, localCtx, funcs)
 			if err != nil {
 				panic(err)
 			}
@@ -394,32 +501,95 @@ func DeclareFunction(ctx Context, funcs Functions, Args []string, Body []parser.
 	}
 }
 
+// evalExists implements exists(x), which reports whether x refers to a defined,
+// non-null value without failing in strict mode.
+func (e *Evaluator) evalExists(args []parser.Expression, ctx Context, funcs Functions) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("exists() expects exactly 1 argument, got %d", len(args))
+	}
+
+	if varExpr, ok := args[0].(*parser.VariableExpr); ok {
+		val, found := lookupVariable(ctx, varExpr.Parts)
+		return found && val != nil, nil
+	}
+
+	strict := *e
+	strict.Options.Strict = true
+	val, err := strict.Evaluate(args[0], ctx, funcs)
+	return err == nil && val != nil, nil
+}
+
+// iterationPairs returns the keys and values a foreach loop visits: indexes
+// and elements for arrays, sorted keys and their values for objects.
+func iterationPairs(iterable interface{}) ([]interface{}, []interface{}, error) {
+	switch v := iterable.(type) {
+	case []interface{}:
+		keys := make([]interface{}, len(v))
+		items := make([]interface{}, len(v))
+		for i := range v {
+			keys[i] = float64(i)
+			items[i] = toScriptValue(v[i])
+		}
+		return keys, items, nil
+	}
+
+	obj, ok := asObject(iterable)
+	if !ok {
+		return nil, nil, fmt.Errorf("foreach loop target must be an array or object")
+	}
+	keys := make([]interface{}, 0, obj.Len())
+	values := make([]interface{}, 0, obj.Len())
+	for _, k := range obj.Keys() {
+		v, _ := obj.Get(k)
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	return keys, values, nil
+}
+
 func AssignToContext(ctx Context, target parser.Expression, value interface{}) error {
 	varExpr, ok := target.(*parser.VariableExpr)
 	if !ok {
 		return fmt.Errorf("assignment target must be variable")
 	}
 
-	cur := ctx
+	var cur interface{} = map[string]interface{}(ctx)
 	for i := 0; i < len(varExpr.Parts)-1; i++ {
 		key := varExpr.Parts[i]
-		child, ok := cur[key].(map[string]interface{})
-		if !ok {
-			child = make(map[string]interface{})
-			cur[key] = child
+		child, _, _ := objectGet(cur, key)
+		if _, _, isObject := objectGet(child, ""); !isObject {
+			child = NewObject()
 		}
+		// store the child back, as objectGet may have converted it
+		setObjectKey(cur, key, child)
 		cur = child
 	}
-	cur[varExpr.Parts[len(varExpr.Parts)-1]] = value
+	setObjectKey(cur, varExpr.Parts[len(varExpr.Parts)-1], value)
 	return nil
 }
 
+// setObjectKey stores value under key in an *Object or a plain map and
+// reports whether target was an object.
+func setObjectKey(target interface{}, key string, value interface{}) bool {
+	switch obj := target.(type) {
+	case *Object:
+		obj.Set(key, value)
+	case map[string]interface{}:
+		obj[key] = value
+	case Context:
+		obj[key] = value
+	default:
+		return false
+	}
+	return true
+}
+
 func checkMemoryLimit() error {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
 	if memStats.Alloc > uint64(MaxMemoryBytes) {
-		return fmt.Errorf("memory limit exceeded (%.2f MB used)", float64(memStats.Alloc))
+		return fmt.Errorf("memory limit of %.2f MB exceeded", float64(MaxMemoryBytes)/(1024*1024))
 	}
 
 	return nil
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"github.com/isaeken/brickengine-go/modules"
+)
+
+// ExecFunctions run commands through Options.Executor, restricted by
+// Options.ExecPolicy.
+func ExecFunctions() Functions {
+	return Functions{
+		"exec.run": func(ctx context.Context, command string, rest ...interface{}) (*Object, error) {
+			req := modules.ExecRequest{Command: command}
+			if len(rest) > 0 && rest[0] != nil {
+				args, ok := rest[0].([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("exec.run: expected array of arguments, got %s", typeName(rest[0]))
+				}
+				for _, arg := range args {
+					req.Args = append(req.Args, revealString(arg))
+				}
+			}
+			if len(rest) > 1 && rest[1] != nil {
+				if err := applyExecOptions(&req, rest[1]); err != nil {
+					return nil, err
+				}
+			}
+			return runCommand(ctx, req)
+		},
+	}
+}
+
+func runCommand(ctx context.Context, req modules.ExecRequest) (*Object, error) {
+	opts := OptionsFrom(ctx)
+	if opts.Executor == nil {
+		return nil, fmt.Errorf("exec.run: no executor configured")
+	}
+	if err := opts.ExecPolicy.Check(req); err != nil {
+		return nil, fmt.Errorf("exec.run: %w", err)
+	}
+	req.MaxOutputBytes = opts.ExecPolicy.MaxOutputBytes
+
+	res, err := opts.Executor.Run(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("exec.run: %w", err)
+	}
+
+	obj := NewObject()
+	obj.Set("stdout", string(res.Stdout))
+	obj.Set("stderr", string(res.Stderr))
+	obj.Set("exit_code", float64(res.ExitCode))
+	obj.Set("ok", res.ExitCode == 0)
+	obj.Set("duration", res.Duration.Seconds())
+	obj.Set("truncated", res.Truncated)
+	return obj, nil
+}
+
+// applyExecOptions reads the env, cwd, stdin, timeout and shell options.
+func applyExecOptions(req *modules.ExecRequest, v interface{}) error {
+	o, err := objectArg("exec.run", v)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := o.Get("env"); ok && v != nil {
+		env, err := objectArg("exec.run: env", v)
+		if err != nil {
+			return err
+		}
+		for _, k := range env.Keys() {
+			ev, _ := env.Get(k)
+			req.Env = append(req.Env, k+"="+revealString(ev))
+		}
+	}
+	if v, ok := o.Get("cwd"); ok && v != nil {
+		req.Dir = revealString(v)
+	}
+	if v, ok := o.Get("stdin"); ok && v != nil {
+		if b, isBytes := v.([]byte); isBytes {
+			req.Stdin = b
+		} else {
+			req.Stdin = []byte(revealString(v))
+		}
+	}
+	if v, ok := o.Get("timeout"); ok && v != nil {
+		d, err := toDuration("exec.run", v)
+		if err != nil {
+			return err
+		}
+		req.Timeout = d
+	}
+	if v, ok := o.Get("shell"); ok {
+		req.Shell = ToBool(v)
+	}
+	return nil
+}
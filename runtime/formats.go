@@ -0,0 +1,634 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatFunctions parse and emit configuration formats. Parsers return
+// objects that keep the key order of the input; emitters keep the order of
+// objects and sort the keys of plain Go maps.
+func FormatFunctions() Functions {
+	return Functions{
+		"to_json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return "", fmt.Errorf("to_json: %w", err)
+			}
+			return string(data), nil
+		},
+		"parse_json": func(s string) (interface{}, error) {
+			v, err := parseJSONOrdered([]byte(s))
+			if err != nil {
+				return nil, fmt.Errorf("parse_json: %w", err)
+			}
+			return v, nil
+		},
+		"parse_yaml": func(s string) (interface{}, error) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(s), &doc); err != nil {
+				return nil, fmt.Errorf("parse_yaml: %w", err)
+			}
+			v, err := yamlValue(&doc)
+			if err != nil {
+				return nil, fmt.Errorf("parse_yaml: %w", err)
+			}
+			return v, nil
+		},
+		"to_yaml": func(v interface{}) (string, error) {
+			node, err := yamlNode(v)
+			if err != nil {
+				return "", fmt.Errorf("to_yaml: %w", err)
+			}
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetIndent(2)
+			if err := enc.Encode(node); err != nil {
+				return "", fmt.Errorf("to_yaml: %w", err)
+			}
+			return buf.String(), nil
+		},
+		"parse_toml": func(s string) (interface{}, error) {
+			var m map[string]interface{}
+			md, err := toml.Decode(s, &m)
+			if err != nil {
+				return nil, fmt.Errorf("parse_toml: %w", err)
+			}
+			return tomlValue(m, nil, tomlKeyOrder(md)), nil
+		},
+		"to_toml": func(v interface{}) (string, error) {
+			obj, ok := asObject(v)
+			if !ok {
+				return "", fmt.Errorf("to_toml: expected object, got %s", typeName(v))
+			}
+			var buf bytes.Buffer
+			if err := writeTOMLTable(&buf, obj, nil); err != nil {
+				return "", fmt.Errorf("to_toml: %w", err)
+			}
+			return buf.String(), nil
+		},
+		"parse_ini": func(s string) (interface{}, error) {
+			cfg, err := ini.LoadSources(ini.LoadOptions{}, []byte(s))
+			if err != nil {
+				return nil, fmt.Errorf("parse_ini: %w", err)
+			}
+			return iniValue(cfg), nil
+		},
+		"to_ini": func(v interface{}) (string, error) {
+			obj, ok := asObject(v)
+			if !ok {
+				return "", fmt.Errorf("to_ini: expected object, got %s", typeName(v))
+			}
+			out, err := writeINI(obj)
+			if err != nil {
+				return "", fmt.Errorf("to_ini: %w", err)
+			}
+			return out, nil
+		},
+		"parse_env": func(s string) (interface{}, error) {
+			obj, err := parseEnv(s)
+			if err != nil {
+				return nil, fmt.Errorf("parse_env: %w", err)
+			}
+			return obj, nil
+		},
+		"to_env": func(v interface{}) (string, error) {
+			obj, ok := asObject(v)
+			if !ok {
+				return "", fmt.Errorf("to_env: expected object, got %s", typeName(v))
+			}
+			out, err := writeEnv(obj)
+			if err != nil {
+				return "", fmt.Errorf("to_env: %w", err)
+			}
+			return out, nil
+		},
+	}
+}
+
+// formatScalar formats a number, string, boolean or time for text formats
+// that have no types of their own.
+func formatScalar(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case Time:
+		return val.String(), nil
+	case time.Time:
+		return Time{val}.String(), nil
+	case Secret:
+		return val.String(), nil
+	}
+	if n, ok := asNumber(v); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("cannot write %s as a plain value", typeName(v))
+}
+
+// yamlValue converts a decoded YAML node to script values, keeping mapping
+// order and resolving aliases and merge keys.
+func yamlValue(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case 0:
+		return nil, nil
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(n.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	case yaml.SequenceNode:
+		arr := make([]interface{}, 0, len(n.Content))
+		for _, el := range n.Content {
+			v, err := yamlValue(el)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case yaml.MappingNode:
+		obj := NewObject()
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			v, err := yamlValue(val)
+			if err != nil {
+				return nil, err
+			}
+
+			if key.Tag == "!!merge" {
+				for _, merged := range mergeSources(v) {
+					for _, k := range merged.Keys() {
+						if _, exists := obj.Get(k); !exists {
+							mv, _ := merged.Get(k)
+							obj.Set(k, mv)
+						}
+					}
+				}
+				continue
+			}
+			obj.Set(key.Value, v)
+		}
+		return obj, nil
+	default:
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		return normalizeYAMLValue(v), nil
+	}
+}
+
+func mergeSources(v interface{}) []*Object {
+	if obj, ok := v.(*Object); ok {
+		return []*Object{obj}
+	}
+	var objs []*Object
+	if arr, ok := v.([]interface{}); ok {
+		for _, el := range arr {
+			if obj, ok := el.(*Object); ok {
+				objs = append(objs, obj)
+			}
+		}
+	}
+	return objs
+}
+
+// yamlNode builds a YAML node for v so object key order is kept on output.
+func yamlNode(v interface{}) (*yaml.Node, error) {
+	if v == nil {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+
+	if obj, ok := asObject(v); ok {
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, k := range obj.Keys() {
+			val, _ := obj.Get(k)
+			child, err := yamlNode(val)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, child)
+		}
+		return node, nil
+	}
+
+	switch val := v.(type) {
+	case Time:
+		v = val.Time
+	case Secret:
+		v = val.String()
+	case []byte:
+		v = string(val)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < rv.Len(); i++ {
+			child, err := yamlNode(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(v); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// tomlKeyOrder returns, for every table path, its keys in the order they
+// appear in the document.
+func tomlKeyOrder(md toml.MetaData) map[string][]string {
+	order := map[string][]string{}
+	seen := map[string]bool{}
+	for _, key := range md.Keys() {
+		full := strings.Join(key, "\x00")
+		if seen[full] {
+			continue
+		}
+		seen[full] = true
+		parent := strings.Join(key[:len(key)-1], "\x00")
+		order[parent] = append(order[parent], key[len(key)-1])
+	}
+	return order
+}
+
+func tomlValue(v interface{}, path []string, order map[string][]string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		obj := NewObject()
+		child := func(k string) interface{} {
+			return tomlValue(val[k], append(append([]string{}, path...), k), order)
+		}
+		for _, k := range order[strings.Join(path, "\x00")] {
+			if _, ok := val[k]; ok {
+				obj.Set(k, child(k))
+			}
+		}
+		for _, k := range sortedKeys(val) {
+			if _, exists := obj.Get(k); !exists {
+				obj.Set(k, child(k))
+			}
+		}
+		return obj
+	case []map[string]interface{}:
+		arr := make([]interface{}, len(val))
+		for i, el := range val {
+			arr[i] = tomlValue(el, path, order)
+		}
+		return arr
+	case []interface{}:
+		arr := make([]interface{}, len(val))
+		for i, el := range val {
+			arr[i] = tomlValue(el, path, order)
+		}
+		return arr
+	case int64:
+		return float64(val)
+	case time.Time:
+		return Time{val}
+	default:
+		return v
+	}
+}
+
+var bareKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if bareKeyRegex.MatchString(k) {
+		return k
+	}
+	return jsonString(k)
+}
+
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// isTableArray reports whether v is a non-empty array of objects, written as
+// [[table]] sections.
+func isTableArray(v interface{}) bool {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) == 0 {
+		return false
+	}
+	for _, el := range arr {
+		if _, ok := asObject(el); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTOMLTable writes the plain keys of obj followed by its sub-tables.
+// Null values are skipped, as TOML has no null.
+func writeTOMLTable(buf *bytes.Buffer, obj *Object, path []string) error {
+	var tables []string
+	for _, k := range obj.Keys() {
+		v, _ := obj.Get(k)
+		if v == nil {
+			continue
+		}
+		if _, ok := asObject(v); ok || isTableArray(v) {
+			tables = append(tables, k)
+			continue
+		}
+		s, err := tomlInline(v)
+		if err != nil {
+			return fmt.Errorf("key '%s': %w", k, err)
+		}
+		fmt.Fprintf(buf, "%s = %s\n", tomlKey(k), s)
+	}
+
+	for _, k := range tables {
+		v, _ := obj.Get(k)
+		childPath := append(append([]string{}, path...), tomlKey(k))
+		header := strings.Join(childPath, ".")
+
+		if sub, ok := asObject(v); ok {
+			if buf.Len() > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(buf, "[%s]\n", header)
+			if err := writeTOMLTable(buf, sub, childPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, el := range v.([]interface{}) {
+			sub, _ := asObject(el)
+			if buf.Len() > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(buf, "[[%s]]\n", header)
+			if err := writeTOMLTable(buf, sub, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tomlInline formats v as an inline TOML value.
+func tomlInline(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", fmt.Errorf("null is not supported")
+	case string:
+		return jsonString(val), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case Time:
+		return val.Format(time.RFC3339Nano), nil
+	case time.Time:
+		return val.Format(time.RFC3339Nano), nil
+	case Secret:
+		return jsonString(val.String()), nil
+	}
+
+	if n, ok := asNumber(v); ok {
+		switch {
+		case math.IsNaN(n):
+			return "nan", nil
+		case math.IsInf(n, 1):
+			return "inf", nil
+		case math.IsInf(n, -1):
+			return "-inf", nil
+		case n == math.Trunc(n) && math.Abs(n) < 1<<53:
+			return strconv.FormatInt(int64(n), 10), nil
+		default:
+			return strconv.FormatFloat(n, 'g', -1, 64), nil
+		}
+	}
+
+	if obj, ok := asObject(v); ok {
+		parts := make([]string, 0, obj.Len())
+		for _, k := range obj.Keys() {
+			el, _ := obj.Get(k)
+			if el == nil {
+				continue
+			}
+			s, err := tomlInline(el)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, tomlKey(k)+" = "+s)
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		parts := make([]string, rv.Len())
+		for i := range parts {
+			s, err := tomlInline(rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	}
+
+	return "", fmt.Errorf("cannot write %s", typeName(v))
+}
+
+// iniValue converts an INI file to an object: keys of the default section at
+// the top level and every other section as a nested object of strings.
+func iniValue(cfg *ini.File) *Object {
+	obj := NewObject()
+	for _, section := range cfg.Sections() {
+		target := obj
+		if section.Name() != ini.DefaultSection {
+			target = NewObject()
+			obj.Set(section.Name(), target)
+		}
+		for _, key := range section.Keys() {
+			target.Set(key.Name(), key.Value())
+		}
+	}
+	return obj
+}
+
+// writeINI writes top-level plain values as keys of the default section and
+// nested objects as sections.
+func writeINI(obj *Object) (string, error) {
+	var top, sections bytes.Buffer
+
+	for _, k := range obj.Keys() {
+		v, _ := obj.Get(k)
+		if section, ok := asObject(v); ok {
+			if sections.Len() > 0 || top.Len() > 0 {
+				sections.WriteString("\n")
+			}
+			fmt.Fprintf(&sections, "[%s]\n", k)
+			for _, sk := range section.Keys() {
+				sv, _ := section.Get(sk)
+				s, err := formatScalar(sv)
+				if err != nil {
+					return "", fmt.Errorf("key '%s.%s': %w", k, sk, err)
+				}
+				fmt.Fprintf(&sections, "%s = %s\n", sk, iniQuote(s))
+			}
+			continue
+		}
+
+		s, err := formatScalar(v)
+		if err != nil {
+			return "", fmt.Errorf("key '%s': %w", k, err)
+		}
+		fmt.Fprintf(&top, "%s = %s\n", k, iniQuote(s))
+	}
+
+	return top.String() + sections.String(), nil
+}
+
+// iniQuote quotes values that would not read back unchanged.
+func iniQuote(s string) string {
+	if s != strings.TrimSpace(s) || strings.ContainsAny(s, ";#\"\n") {
+		return `"""` + s + `"""`
+	}
+	return s
+}
+
+var envKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// parseEnv parses a dotenv file: KEY=value lines, optionally prefixed with
+// "export", with single-quoted (literal) or double-quoted (escaped) values
+// and # comments.
+func parseEnv(s string) (*Object, error) {
+	obj := NewObject()
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !envKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid line '%s'", i+1, lines[i])
+		}
+		value = strings.TrimSpace(value)
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			quote := value[0]
+			body := value[1:]
+			// quoted values may span lines
+			for !hasClosingQuote(body, quote) && i+1 < len(lines) {
+				i++
+				body += "\n" + lines[i]
+			}
+			end := closingQuote(body, quote)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value for '%s'", i+1, key)
+			}
+			if quote == '"' {
+				body = unescapeEnv(body[:end])
+			} else {
+				body = body[:end]
+			}
+			obj.Set(key, body)
+			continue
+		}
+
+		if idx := strings.Index(value, " #"); idx >= 0 {
+			value = strings.TrimSpace(value[:idx])
+		}
+		obj.Set(key, value)
+	}
+	return obj, nil
+}
+
+func hasClosingQuote(s string, quote byte) bool {
+	return closingQuote(s, quote) >= 0
+}
+
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeEnv(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+	return out.String()
+}
+
+// writeEnv writes one KEY=value line per key, double-quoting values that
+// contain whitespace, quotes, # or newlines.
+func writeEnv(obj *Object) (string, error) {
+	var out strings.Builder
+	for _, k := range obj.Keys() {
+		if !envKeyRegex.MatchString(k) {
+			return "", fmt.Errorf("invalid variable name '%s'", k)
+		}
+		v, _ := obj.Get(k)
+		s, err := formatScalar(v)
+		if err != nil {
+			return "", fmt.Errorf("key '%s': %w", k, err)
+		}
+		if strings.ContainsAny(s, " \t\n\r\"'#\\$`") {
+			r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+			s = `"` + r.Replace(s) + `"`
+		}
+		fmt.Fprintf(&out, "%s=%s\n", k, s)
+	}
+	return out.String(), nil
+}
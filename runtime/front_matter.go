@@ -0,0 +1,240 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TemplateInput describes a variable a template expects in its Context.
+// Name is a dotted path such as "vars.hostname".
+type TemplateInput struct {
+	Name        string        `yaml:"name" json:"name"`
+	Type        string        `yaml:"type" json:"type,omitempty"`
+	Default     interface{}   `yaml:"default" json:"default,omitempty"`
+	Required    bool          `yaml:"required" json:"required"`
+	Description string        `yaml:"description" json:"description,omitempty"`
+	Allowed     []interface{} `yaml:"allowed" json:"allowed,omitempty"`
+}
+
+type frontMatter struct {
+	Inputs []TemplateInput `yaml:"inputs"`
+}
+
+const frontMatterFence = "---"
+
+// InspectTemplate returns the inputs declared in a template's front matter.
+func InspectTemplate(input string) ([]TemplateInput, error) {
+	inputs, _, err := splitFrontMatter(input)
+	return inputs, err
+}
+
+// splitFrontMatter separates a leading front-matter block from the template
+// body. A block only counts as front matter when it declares "inputs", so
+// plain YAML documents starting with "---" render unchanged.
+func splitFrontMatter(input string) ([]TemplateInput, string, error) {
+	first, rest, ok := cutLine(input)
+	if !ok || first != frontMatterFence {
+		return nil, input, nil
+	}
+
+	var block []string
+	for rest != "" {
+		var line string
+		line, rest, _ = cutLine(rest)
+		if line == frontMatterFence {
+			return parseFrontMatter(block, input, rest)
+		}
+		block = append(block, line)
+	}
+
+	return nil, input, nil
+}
+
+func parseFrontMatter(block []string, input string, body string) ([]TemplateInput, string, error) {
+	declaresInputs := false
+	for _, line := range block {
+		if strings.HasPrefix(line, "inputs:") {
+			declaresInputs = true
+			break
+		}
+	}
+	if !declaresInputs {
+		return nil, input, nil
+	}
+
+	var fm frontMatter
+	if err := yaml.Unmarshal([]byte(strings.Join(block, "\n")), &fm); err != nil {
+		return nil, "", fmt.Errorf("invalid template front matter: %w", err)
+	}
+
+	for i, in := range fm.Inputs {
+		if in.Name == "" {
+			return nil, "", fmt.Errorf("invalid template front matter: input #%d has no name", i+1)
+		}
+		switch in.Type {
+		case "", "any", "string", "number", "boolean", "array", "object":
+		default:
+			return nil, "", fmt.Errorf("invalid template front matter: unknown type '%s' for input '%s'", in.Type, in.Name)
+		}
+		fm.Inputs[i].Default = normalizeYAMLValue(in.Default)
+		for j, v := range in.Allowed {
+			fm.Inputs[i].Allowed[j] = normalizeYAMLValue(v)
+		}
+		if err := checkDefault(fm.Inputs[i]); err != nil {
+			return nil, "", fmt.Errorf("invalid template front matter: %w", err)
+		}
+	}
+
+	return fm.Inputs, body, nil
+}
+
+// checkDefault reports whether the default of in breaks its own type or
+// allowed list.
+func checkDefault(in TemplateInput) error {
+	if in.Default == nil {
+		return nil
+	}
+	if !matchesInputType(in.Default, in.Type) {
+		return fmt.Errorf("default of input '%s' must be of type %s, got %s", in.Name, in.Type, typeName(in.Default))
+	}
+	if len(in.Allowed) > 0 && !containsValue(in.Allowed, in.Default) {
+		return fmt.Errorf("default of input '%s' must be one of %v, got %v", in.Name, in.Allowed, in.Default)
+	}
+	return nil
+}
+
+func cutLine(s string) (string, string, bool) {
+	line, rest, found := strings.Cut(s, "\n")
+	return strings.TrimSuffix(line, "\r"), rest, found
+}
+
+// applyInputs validates ctx against the declared inputs and returns a context
+// with defaults filled in. The caller's context is left untouched.
+func applyInputs(inputs []TemplateInput, ctx Context) (Context, error) {
+	var errs []error
+
+	for _, in := range inputs {
+		parts := strings.Split(in.Name, ".")
+		val, found := lookupVariable(ctx, parts)
+
+		if !found || val == nil {
+			if in.Default != nil {
+				ctx = withValue(ctx, parts, in.Default)
+				continue
+			}
+			if in.Required {
+				errs = append(errs, fmt.Errorf("input '%s' is required", in.Name))
+			}
+			continue
+		}
+
+		if !matchesInputType(val, in.Type) {
+			errs = append(errs, fmt.Errorf("input '%s' must be of type %s, got %s", in.Name, in.Type, typeName(val)))
+			continue
+		}
+
+		if len(in.Allowed) > 0 && !containsValue(in.Allowed, val) {
+			errs = append(errs, fmt.Errorf("input '%s' must be one of %v, got %v", in.Name, in.Allowed, val))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid template inputs: %w", errors.Join(errs...))
+	}
+	return ctx, nil
+}
+
+func matchesInputType(val interface{}, typ string) bool {
+	switch typ {
+	case "", "any":
+		return true
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "boolean":
+		_, ok := val.(bool)
+		return ok
+	case "number":
+		return isNumberKind(reflect.ValueOf(val).Kind())
+	case "array":
+		kind := reflect.ValueOf(val).Kind()
+		return kind == reflect.Slice || kind == reflect.Array
+	case "object":
+		_, ok := asObject(val)
+		return ok
+	default:
+		return false
+	}
+}
+
+func containsValue(values []interface{}, val interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, val) {
+			return true
+		}
+		if lf, ok := ToFloat(v); ok {
+			if rf, ok := ToFloat(val); ok && lf == rf {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withValue returns a copy of ctx with value set at parts, copying every
+// object along the path so shared nested objects are not modified.
+func withValue(ctx Context, parts []string, value interface{}) Context {
+	root := make(Context, len(ctx)+1)
+	for k, v := range ctx {
+		root[k] = v
+	}
+
+	segments := make([]pathSegment, len(parts)-1)
+	for i, key := range parts[1:] {
+		segments[i] = pathSegment{key: key}
+	}
+	if len(segments) == 0 {
+		root[parts[0]] = value
+		return root
+	}
+
+	current := root[parts[0]]
+	if _, ok := asObject(current); !ok {
+		current = nil
+	}
+	if child, err := setPath(current, segments, value); err == nil {
+		root[parts[0]] = child
+	}
+	return root
+}
+
+// normalizeYAMLValue converts decoded YAML integers to float64 and timestamps
+// to Time, matching the representation used by scripts.
+func normalizeYAMLValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case int:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case time.Time:
+		return Time{val}
+	case []interface{}:
+		for i, el := range val {
+			val[i] = normalizeYAMLValue(el)
+		}
+		return val
+	case map[string]interface{}:
+		for k, el := range val {
+			val[k] = normalizeYAMLValue(el)
+		}
+		return val
+	default:
+		return v
+	}
+}
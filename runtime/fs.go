@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"github.com/isaeken/brickengine-go/modules"
+	"io/fs"
+)
+
+// FSReadFunctions read from the file system configured in Options.FS.
+func FSReadFunctions() Functions {
+	return Functions{
+		"fs.read": func(ctx context.Context, p string) (string, error) {
+			fsys, name, err := fsPath(ctx, "fs.read", p)
+			if err != nil {
+				return "", err
+			}
+			data, err := fsys.ReadFile(name)
+			if err != nil {
+				return "", fmt.Errorf("fs.read: %w", err)
+			}
+			return string(data), nil
+		},
+		"fs.exists": func(ctx context.Context, p string) (bool, error) {
+			fsys, name, err := fsPath(ctx, "fs.exists", p)
+			if err != nil {
+				return false, err
+			}
+			_, err = fsys.Stat(name)
+			return err == nil, nil
+		},
+		"fs.list": func(ctx context.Context, p ...string) ([]interface{}, error) {
+			dir := "."
+			if len(p) > 0 {
+				dir = p[0]
+			}
+			fsys, name, err := fsPath(ctx, "fs.list", dir)
+			if err != nil {
+				return nil, err
+			}
+			entries, err := fsys.ReadDir(name)
+			if err != nil {
+				return nil, fmt.Errorf("fs.list: %w", err)
+			}
+			names := make([]interface{}, len(entries))
+			for i, entry := range entries {
+				names[i] = entry.Name()
+			}
+			return names, nil
+		},
+		"fs.glob": func(ctx context.Context, pattern string) ([]interface{}, error) {
+			fsys, name, err := fsPath(ctx, "fs.glob", pattern)
+			if err != nil {
+				return nil, err
+			}
+			matches, err := fs.Glob(fsys, name)
+			if err != nil {
+				return nil, fmt.Errorf("fs.glob: %w", err)
+			}
+			paths := make([]interface{}, len(matches))
+			for i, m := range matches {
+				paths[i] = m
+			}
+			return paths, nil
+		},
+		"fs.stat": func(ctx context.Context, p string) (*Object, error) {
+			fsys, name, err := fsPath(ctx, "fs.stat", p)
+			if err != nil {
+				return nil, err
+			}
+			info, err := fsys.Stat(name)
+			if err != nil {
+				return nil, fmt.Errorf("fs.stat: %w", err)
+			}
+			obj := NewObject()
+			obj.Set("name", info.Name())
+			obj.Set("path", name)
+			obj.Set("size", float64(info.Size()))
+			obj.Set("is_dir", info.IsDir())
+			obj.Set("mode", fmt.Sprintf("%04o", info.Mode().Perm()))
+			obj.Set("modified", Time{info.ModTime()})
+			return obj, nil
+		},
+	}
+}
+
+// FSWriteFunctions change the file system configured in Options.FS.
+func FSWriteFunctions() Functions {
+	return Functions{
+		"fs.write": func(ctx context.Context, p string, content interface{}) (bool, error) {
+			fsys, name, err := fsPath(ctx, "fs.write", p)
+			if err != nil {
+				return false, err
+			}
+			data, ok := content.([]byte)
+			if !ok {
+				data = []byte(formatTemplateValue(content))
+			}
+			if err := fsys.WriteFile(name, data); err != nil {
+				return false, fmt.Errorf("fs.write: %w", err)
+			}
+			return true, nil
+		},
+		"fs.mkdir": func(ctx context.Context, p string) (bool, error) {
+			fsys, name, err := fsPath(ctx, "fs.mkdir", p)
+			if err != nil {
+				return false, err
+			}
+			if err := fsys.MkdirAll(name); err != nil {
+				return false, fmt.Errorf("fs.mkdir: %w", err)
+			}
+			return true, nil
+		},
+		"fs.remove": func(ctx context.Context, p string) (bool, error) {
+			fsys, name, err := fsPath(ctx, "fs.remove", p)
+			if err != nil {
+				return false, err
+			}
+			if err := fsys.RemoveAll(name); err != nil {
+				return false, fmt.Errorf("fs.remove: %w", err)
+			}
+			return true, nil
+		},
+	}
+}
+
+// fsPath returns the run's file system and the cleaned name of p.
+func fsPath(ctx context.Context, fn, p string) (modules.FileSystem, string, error) {
+	fsys := OptionsFrom(ctx).FS
+	if fsys == nil {
+		return nil, "", fmt.Errorf("%s: no file system configured", fn)
+	}
+	name, err := modules.CleanPath(p)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", fn, err)
+	}
+	return fsys, name, nil
+}
@@ -1,13 +1,12 @@
 package runtime
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/gosimple/slug"
 	"github.com/isaeken/brickengine-go/modules"
+	"github.com/isaeken/brickengine-go/units"
 	"math"
-	"math/rand"
 	"reflect"
 	"sort"
 	"strings"
@@ -16,20 +15,10 @@ import (
 
 func UUIDAndFormatFunctions() Functions {
 	return Functions{
-		"uuid":   func() string { return uuid.NewString() },
+		"uuid":   NewUUID,
 		"slug":   func(s string) string { return slug.Make(s) },
-		"random": func() float64 { return rand.Float64() },
-		"now":    func() string { return time.Now().UTC().Format(time.RFC3339) },
+		"random": func(ctx context.Context) float64 { return RandFrom(ctx).Float64() },
 		"format": func(v interface{}) string { return fmt.Sprintf("%v", v) },
-		"to_json": func(v interface{}) string {
-			data, _ := json.Marshal(v)
-			return string(data)
-		},
-		"parse_json": func(s string) interface{} {
-			var out interface{}
-			json.Unmarshal([]byte(s), &out)
-			return out
-		},
 	}
 }
 
@@ -69,11 +58,16 @@ func StringFunctions() Functions {
 			}
 			return string(r)
 		},
-		"random_str": func() string {
+		"random_str": func(ctx context.Context, length ...float64) string {
+			rng := RandFrom(ctx)
 			const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-			b := make([]byte, 8)
+			n := 8
+			if len(length) > 0 {
+				n = max(int(length[0]), 0)
+			}
+			b := make([]byte, n)
 			for i := range b {
-				b[i] = charset[rand.Intn(len(charset))]
+				b[i] = charset[rng.Intn(len(charset))]
 			}
 			return string(b)
 		},
@@ -107,22 +101,6 @@ func TypeFunctions() Functions {
 		"to_bool": func(v interface{}) bool {
 			return v.(bool)
 		},
-		"type_of": func(v interface{}) string {
-			switch reflect.TypeOf(v).Kind() {
-			case reflect.Slice:
-				return "array"
-			case reflect.Map:
-				return "object"
-			case reflect.String:
-				return "string"
-			case reflect.Float64, reflect.Float32, reflect.Int, reflect.Int64:
-				return "number"
-			case reflect.Bool:
-				return "boolean"
-			default:
-				return "unknown"
-			}
-		},
 	}
 }
 
@@ -174,17 +152,10 @@ func ArrayFunctions() Functions {
 			return res
 		},
 		"sort": func(arr []interface{}) []interface{} {
-			clone := make([]float64, 0)
-			for _, v := range arr {
-				if num, ok := v.(float64); ok {
-					clone = append(clone, num)
-				}
-			}
-			sort.Float64s(clone)
-			res := make([]interface{}, len(clone))
-			for i, v := range clone {
-				res[i] = v
-			}
+			res := append([]interface{}{}, arr...)
+			sort.SliceStable(res, func(i, j int) bool {
+				return compareValues(res[i], res[j]) < 0
+			})
 			return res
 		},
 		"slice": func(arr []interface{}, start, end float64) []interface{} {
@@ -198,33 +169,610 @@ func ArrayFunctions() Functions {
 		"concat": func(arr1, arr2 []interface{}) []interface{} {
 			return append(arr1, arr2...)
 		},
+		"map": func(ctx context.Context, arr []interface{}, fn interface{}) ([]interface{}, error) {
+			res := make([]interface{}, len(arr))
+			for i, item := range arr {
+				val, err := callFunction(ctx, "map callback", fn, []interface{}{item, float64(i)})
+				if err != nil {
+					return nil, err
+				}
+				res[i] = val
+			}
+			return res, nil
+		},
+		"filter": func(ctx context.Context, arr []interface{}, fn interface{}) ([]interface{}, error) {
+			res := []interface{}{}
+			for i, item := range arr {
+				keep, err := callFunction(ctx, "filter callback", fn, []interface{}{item, float64(i)})
+				if err != nil {
+					return nil, err
+				}
+				if IsTruthy(keep) {
+					res = append(res, item)
+				}
+			}
+			return res, nil
+		},
+		"reduce": func(ctx context.Context, arr []interface{}, fn interface{}, initial ...interface{}) (interface{}, error) {
+			var acc interface{}
+			start := 0
+			if len(initial) > 0 {
+				acc = initial[0]
+			} else if len(arr) > 0 {
+				acc = arr[0]
+				start = 1
+			}
+
+			for i := start; i < len(arr); i++ {
+				val, err := callFunction(ctx, "reduce callback", fn, []interface{}{acc, arr[i], float64(i)})
+				if err != nil {
+					return nil, err
+				}
+				acc = val
+			}
+			return acc, nil
+		},
+		"find": func(ctx context.Context, arr []interface{}, fn interface{}) (interface{}, error) {
+			for i, item := range arr {
+				ok, err := callFunction(ctx, "find callback", fn, []interface{}{item, float64(i)})
+				if err != nil {
+					return nil, err
+				}
+				if IsTruthy(ok) {
+					return item, nil
+				}
+			}
+			return nil, nil
+		},
+		"some": func(ctx context.Context, arr []interface{}, fn interface{}) (bool, error) {
+			for i, item := range arr {
+				ok, err := callFunction(ctx, "some callback", fn, []interface{}{item, float64(i)})
+				if err != nil {
+					return false, err
+				}
+				if IsTruthy(ok) {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+		"every": func(ctx context.Context, arr []interface{}, fn interface{}) (bool, error) {
+			for i, item := range arr {
+				ok, err := callFunction(ctx, "every callback", fn, []interface{}{item, float64(i)})
+				if err != nil {
+					return false, err
+				}
+				if !IsTruthy(ok) {
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+		"sort_by": func(ctx context.Context, arr []interface{}, fn interface{}, descending ...bool) ([]interface{}, error) {
+			type keyed struct {
+				key  interface{}
+				item interface{}
+			}
+
+			items := make([]keyed, len(arr))
+			for i, item := range arr {
+				key, err := callFunction(ctx, "sort_by callback", fn, []interface{}{item})
+				if err != nil {
+					return nil, err
+				}
+				items[i] = keyed{key: key, item: item}
+			}
+
+			desc := len(descending) > 0 && descending[0]
+			sort.SliceStable(items, func(i, j int) bool {
+				if desc {
+					return compareValues(items[i].key, items[j].key) > 0
+				}
+				return compareValues(items[i].key, items[j].key) < 0
+			})
+
+			res := make([]interface{}, len(items))
+			for i, k := range items {
+				res[i] = k.item
+			}
+			return res, nil
+		},
+		"group_by": func(ctx context.Context, arr []interface{}, fn interface{}) (*Object, error) {
+			groups := NewObject()
+			for _, item := range arr {
+				key, err := callFunction(ctx, "group_by callback", fn, []interface{}{item})
+				if err != nil {
+					return nil, err
+				}
+				k := keyString(key)
+				group, _ := groups.Get(k)
+				items, _ := group.([]interface{})
+				groups.Set(k, append(items, item))
+			}
+			return groups, nil
+		},
+		"unique": func(arr []interface{}) []interface{} {
+			return uniqueBy(arr, arr)
+		},
+		"unique_by": func(ctx context.Context, arr []interface{}, fn interface{}) ([]interface{}, error) {
+			keys := make([]interface{}, len(arr))
+			for i, item := range arr {
+				key, err := callFunction(ctx, "unique_by callback", fn, []interface{}{item})
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = key
+			}
+			return uniqueBy(arr, keys), nil
+		},
+		"flatten": func(arr []interface{}, depth ...float64) []interface{} {
+			d := -1
+			if len(depth) > 0 {
+				d = int(depth[0])
+			}
+			return flatten(arr, d)
+		},
+		"zip": func(arrs ...[]interface{}) []interface{} {
+			if len(arrs) == 0 {
+				return []interface{}{}
+			}
+			n := len(arrs[0])
+			for _, arr := range arrs[1:] {
+				n = min(n, len(arr))
+			}
+
+			res := make([]interface{}, n)
+			for i := range res {
+				tuple := make([]interface{}, len(arrs))
+				for j, arr := range arrs {
+					tuple[j] = arr[i]
+				}
+				res[i] = tuple
+			}
+			return res
+		},
+		"chunk": func(arr []interface{}, size float64) ([]interface{}, error) {
+			n := int(size)
+			if n < 1 {
+				return nil, fmt.Errorf("chunk size must be at least 1")
+			}
+			res := []interface{}{}
+			for i := 0; i < len(arr); i += n {
+				res = append(res, append([]interface{}{}, arr[i:min(i+n, len(arr))]...))
+			}
+			return res, nil
+		},
+		"range": func(ctx context.Context, args ...float64) ([]interface{}, error) {
+			start, end, step := 0.0, 0.0, 1.0
+			switch len(args) {
+			case 1:
+				end = args[0]
+			case 2:
+				start, end = args[0], args[1]
+			case 3:
+				start, end, step = args[0], args[1], args[2]
+			default:
+				return nil, fmt.Errorf("range expects 1 to 3 arguments, got %d", len(args))
+			}
+			if step == 0 {
+				return nil, fmt.Errorf("range step cannot be zero")
+			}
+			n := math.Max(math.Ceil((end-start)/step), 0)
+			if !(n <= float64(MaxRangeLength)) {
+				return nil, fmt.Errorf("range of %.0f elements exceeds the limit of %d", n, MaxRangeLength)
+			}
+			if err := stateFrom(ctx).charge(int(n)); err != nil {
+				return nil, fmt.Errorf("range: %w", err)
+			}
+
+			res := make([]interface{}, 0, int(n))
+			for v := start; (step > 0 && v < end) || (step < 0 && v > end); v += step {
+				res = append(res, v)
+			}
+			return res, nil
+		},
+		"sum": func(arr []interface{}) (float64, error) {
+			return sumNumbers("sum", arr)
+		},
+		"avg": func(arr []interface{}) (float64, error) {
+			if len(arr) == 0 {
+				return 0, nil
+			}
+			total, err := sumNumbers("avg", arr)
+			return total / float64(len(arr)), err
+		},
+	}
+}
+
+// uniqueBy keeps the first item of arr for every distinct key in keys.
+func uniqueBy(arr []interface{}, keys []interface{}) []interface{} {
+	res := []interface{}{}
+	seen := map[interface{}]bool{}
+	var seenOther []interface{}
+
+	for i, item := range arr {
+		switch key := keys[i].(type) {
+		case nil, bool, string, float64:
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		default:
+			dup := false
+			for _, other := range seenOther {
+				if reflect.DeepEqual(other, key) {
+					dup = true
+					break
+				}
+			}
+			if dup {
+				continue
+			}
+			seenOther = append(seenOther, key)
+		}
+		res = append(res, item)
 	}
+	return res
+}
+
+// flatten expands nested arrays up to depth levels; a negative depth
+// flattens completely.
+func flatten(arr []interface{}, depth int) []interface{} {
+	res := []interface{}{}
+	for _, item := range arr {
+		if nested, ok := item.([]interface{}); ok && depth != 0 {
+			res = append(res, flatten(nested, depth-1)...)
+			continue
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
+func sumNumbers(name string, arr []interface{}) (float64, error) {
+	total := 0.0
+	for i, item := range arr {
+		n, ok := asNumber(item)
+		if !ok {
+			return 0, fmt.Errorf("%s: element %d is %s, not a number", name, i, typeName(item))
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func ObjectFunctions() Functions {
+	return Functions{
+		"keys": func(obj interface{}) ([]interface{}, error) {
+			o, err := objectArg("keys", obj)
+			if err != nil {
+				return nil, err
+			}
+			keys := []interface{}{}
+			for _, k := range o.Keys() {
+				keys = append(keys, k)
+			}
+			return keys, nil
+		},
+		"values": func(obj interface{}) ([]interface{}, error) {
+			o, err := objectArg("values", obj)
+			if err != nil {
+				return nil, err
+			}
+			values := []interface{}{}
+			for _, k := range o.Keys() {
+				v, _ := o.Get(k)
+				values = append(values, v)
+			}
+			return values, nil
+		},
+		"entries": func(obj interface{}) ([]interface{}, error) {
+			o, err := objectArg("entries", obj)
+			if err != nil {
+				return nil, err
+			}
+			entries := []interface{}{}
+			for _, k := range o.Keys() {
+				v, _ := o.Get(k)
+				entries = append(entries, []interface{}{k, v})
+			}
+			return entries, nil
+		},
+		"has": func(obj interface{}, key string) bool {
+			_, found, _ := objectGet(obj, key)
+			return found
+		},
+		"merge": func(objs ...interface{}) (*Object, error) {
+			res := NewObject()
+			for _, obj := range objs {
+				o, err := objectArg("merge", obj)
+				if err != nil {
+					return nil, err
+				}
+				for _, k := range o.Keys() {
+					v, _ := o.Get(k)
+					res.Set(k, v)
+				}
+			}
+			return res, nil
+		},
+		"deep_merge": func(base, override interface{}, opts ...interface{}) (*Object, error) {
+			b, err := objectArg("deep_merge", base)
+			if err != nil {
+				return nil, err
+			}
+			o, err := objectArg("deep_merge", override)
+			if err != nil {
+				return nil, err
+			}
+
+			strategy := "replace"
+			if len(opts) > 0 {
+				if arrays, found, _ := objectGet(opts[0], "arrays"); found {
+					strategy = fmt.Sprint(arrays)
+				}
+			}
+			switch strategy {
+			case "replace", "append", "unique", "merge":
+			default:
+				return nil, fmt.Errorf("deep_merge: unknown array strategy '%s'", strategy)
+			}
+			return deepMerge(b, o, strategy), nil
+		},
+		"pick": func(obj interface{}, keys []string) (*Object, error) {
+			o, err := objectArg("pick", obj)
+			if err != nil {
+				return nil, err
+			}
+			res := NewObject()
+			for _, k := range keys {
+				if v, ok := o.Get(k); ok {
+					res.Set(k, v)
+				}
+			}
+			return res, nil
+		},
+		"omit": func(obj interface{}, keys []string) (*Object, error) {
+			o, err := objectArg("omit", obj)
+			if err != nil {
+				return nil, err
+			}
+			res := o.Clone()
+			for _, k := range keys {
+				res.Delete(k)
+			}
+			return res, nil
+		},
+		"get": func(obj interface{}, path string, fallback ...interface{}) (interface{}, error) {
+			segments, err := parsePath(path)
+			if err != nil {
+				return nil, err
+			}
+			if val, ok := getPath(obj, segments); ok {
+				return val, nil
+			}
+			if len(fallback) > 0 {
+				return fallback[0], nil
+			}
+			return nil, nil
+		},
+		"set": func(obj interface{}, path string, value interface{}) (interface{}, error) {
+			segments, err := parsePath(path)
+			if err != nil {
+				return nil, err
+			}
+			return setPath(obj, segments, value)
+		},
+		"delete": func(obj interface{}, path string) (interface{}, error) {
+			segments, err := parsePath(path)
+			if err != nil {
+				return nil, err
+			}
+			return deletePath(obj, segments), nil
+		},
+	}
+}
+
+// intBounds converts the bounds of a random integer range to int64,
+// rejecting those it cannot hold.
+func intBounds(name string, min, max float64) (int64, int64, error) {
+	for _, v := range []float64{min, max} {
+		if math.IsNaN(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, 0, fmt.Errorf("%s: %v is out of range", name, v)
+		}
+	}
+	return int64(min), int64(max), nil
+}
+
+// objectArg converts a function argument to an *Object. The returned object
+// may be shared with the caller and must be cloned before modification.
+func objectArg(name string, v interface{}) (*Object, error) {
+	o, ok := asObject(v)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected object, got %s", name, typeName(v))
+	}
+	return o, nil
 }
 
 func UtilFunctions() Functions {
 	return Functions{
 		"type_of": func(v interface{}) string {
-			return reflect.TypeOf(v).String()
+			return typeName(v)
 		},
 	}
 }
 
-func HttpFunctions() Functions {
+// RandomFunctions returns the random helpers. The seeded ones use the run's
+// random source and are reproducible in deterministic mode; the secure ones
+// always read crypto/rand and are the ones to use for secrets.
+func RandomFunctions() Functions {
 	return Functions{
-		"http.get": modules.HttpGet,
+		"random_int": func(ctx context.Context, min, max float64) (float64, error) {
+			lo, hi, err := intBounds("random_int", min, max)
+			if err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("random_int: min %v is greater than max %v", min, max)
+			}
+			span := hi - lo
+			if span < 0 || span == math.MaxInt64 {
+				return 0, fmt.Errorf("random_int: range from %v to %v is too large", min, max)
+			}
+			return float64(lo + RandFrom(ctx).Int63n(span+1)), nil
+		},
+		"random_choice": func(ctx context.Context, arr []interface{}) interface{} {
+			if len(arr) == 0 {
+				return nil
+			}
+			return arr[RandFrom(ctx).Intn(len(arr))]
+		},
+		"shuffle": func(ctx context.Context, arr []interface{}) []interface{} {
+			res := append([]interface{}{}, arr...)
+			RandFrom(ctx).Shuffle(len(res), func(i, j int) {
+				res[i], res[j] = res[j], res[i]
+			})
+			return res
+		},
+		"secure_random_bytes": func(n float64) ([]byte, error) {
+			b, err := modules.SecureRandomBytes(int(n))
+			if err != nil {
+				return nil, fmt.Errorf("secure_random_bytes: %w", err)
+			}
+			return b, nil
+		},
+		"secure_random_int": func(min, max float64) (float64, error) {
+			lo, hi, err := intBounds("secure_random_int", min, max)
+			if err != nil {
+				return 0, err
+			}
+			n, err := modules.SecureRandomInt(lo, hi)
+			if err != nil {
+				return 0, fmt.Errorf("secure_random_int: %w", err)
+			}
+			return float64(n), nil
+		},
+		"password": func(length float64, opts ...interface{}) (string, error) {
+			policy := modules.DefaultPasswordPolicy()
+			if len(opts) > 0 {
+				o, err := objectArg("password", opts[0])
+				if err != nil {
+					return "", err
+				}
+				applyPasswordOptions(&policy, o)
+			}
+			pw, err := modules.Password(int(length), policy)
+			if err != nil {
+				return "", fmt.Errorf("password: %w", err)
+			}
+			return pw, nil
+		},
+	}
+}
+
+// applyPasswordOptions reads lower, upper, digits, symbols (a boolean or the
+// symbol characters), min_lower, min_upper, min_digits, min_symbols and
+// exclude from o.
+func applyPasswordOptions(p *modules.PasswordPolicy, o *Object) {
+	flags := map[string]*bool{"lower": &p.Lower, "upper": &p.Upper, "digits": &p.Digits}
+	for name, dst := range flags {
+		if v, ok := o.Get(name); ok {
+			*dst = ToBool(v)
+		}
+	}
+
+	if v, ok := o.Get("symbols"); ok {
+		switch sym := v.(type) {
+		case string:
+			p.Symbols = sym
+		default:
+			p.Symbols = ""
+			if ToBool(sym) {
+				p.Symbols = modules.DefaultSymbols
+			}
+		}
+	}
+
+	mins := map[string]*int{
+		"min_lower": &p.MinLower, "min_upper": &p.MinUpper,
+		"min_digits": &p.MinDigits, "min_symbols": &p.MinSymbols,
+	}
+	for name, dst := range mins {
+		if v, ok := o.Get(name); ok {
+			if n, isNumber := asNumber(v); isNumber {
+				*dst = int(n)
+			}
+		}
+	}
+
+	if v, ok := o.Get("exclude"); ok {
+		p.Exclude = formatOutput(v)
+	}
+}
+
+func NetFunctions() Functions {
+	return Functions{
+		"ip_in_cidr":     modules.IPInCIDR,
+		"cidr_host":      modules.CIDRHost,
+		"cidr_subnet":    modules.CIDRSubnet,
+		"cidr_netmask":   modules.CIDRNetmask,
+		"cidr_broadcast": modules.CIDRBroadcast,
+		"ip_to_int":      modules.IPToInt,
+		"int_to_ip":      modules.IntToIP,
+		"random_ipv4_in": func(ctx context.Context, cidr string) (string, error) {
+			return modules.RandomIPv4In(RandFrom(ctx), cidr)
+		},
+		"random_mac": func(ctx context.Context, opts ...interface{}) (string, error) {
+			oui, local := "", true
+			if len(opts) > 0 {
+				o, err := objectArg("random_mac", opts[0])
+				if err != nil {
+					return "", err
+				}
+				if v, ok := o.Get("oui"); ok {
+					oui = formatOutput(v)
+					local = false
+				}
+				if v, ok := o.Get("local"); ok {
+					local = ToBool(v)
+				}
+			}
+			return modules.RandomMAC(RandFrom(ctx), oui, local)
+		},
+	}
+}
+
+func UnitFunctions() Functions {
+	return Functions{
+		"parse_size": units.ParseSize,
+		"size_in":    units.ConvertSize,
+		"format_size": func(bytes float64, unit ...string) (string, error) {
+			if len(unit) > 0 {
+				return units.FormatSize(bytes, unit[0])
+			}
+			return units.FormatSize(bytes, "")
+		},
+		"parse_duration": func(s string) (float64, error) {
+			d, err := parseDuration(s)
+			if err != nil {
+				return 0, fmt.Errorf("parse_duration: %w", err)
+			}
+			return d.Seconds(), nil
+		},
+		"format_duration": func(seconds float64) string {
+			return formatDuration(time.Duration(seconds * float64(time.Second)))
+		},
 	}
 }
 
+// DefaultFunctions returns the functions of every default module with all
+// capabilities granted. Use NewEngine to run untrusted scripts.
 func DefaultFunctions() Functions {
-	return mergeFunctions([]Functions{
-		UUIDAndFormatFunctions(),
-		StringFunctions(),
-		MathFunctions(),
-		TypeFunctions(),
-		ArrayFunctions(),
-		UtilFunctions(),
-		HttpFunctions(),
-	}...)
+	var groups []Functions
+	for _, m := range DefaultModules() {
+		groups = append(groups, m.Functions)
+	}
+	return mergeFunctions(groups...)
 }
 
 func mergeFunctions(fns ...Functions) Functions {
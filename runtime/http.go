@@ -0,0 +1,250 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/isaeken/brickengine-go/modules"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func HttpFunctions() Functions {
+	withoutBody := func(method string) interface{} {
+		name := "http." + strings.ToLower(method)
+		return func(ctx context.Context, rawURL string, opts ...interface{}) (*Object, error) {
+			req := modules.HttpRequest{Method: method, URL: rawURL}
+			if len(opts) > 0 {
+				if err := applyHttpOptions(name, &req, opts[0]); err != nil {
+					return nil, err
+				}
+			}
+			return doHttp(ctx, name, req)
+		}
+	}
+	withBody := func(method string) interface{} {
+		name := "http." + strings.ToLower(method)
+		return func(ctx context.Context, rawURL string, args ...interface{}) (*Object, error) {
+			req := modules.HttpRequest{Method: method, URL: rawURL}
+			if len(args) > 0 && args[0] != nil {
+				if err := setHttpBody(name, &req, args[0]); err != nil {
+					return nil, err
+				}
+			}
+			if len(args) > 1 {
+				if err := applyHttpOptions(name, &req, args[1]); err != nil {
+					return nil, err
+				}
+			}
+			return doHttp(ctx, name, req)
+		}
+	}
+
+	return Functions{
+		"http.get":    withoutBody("GET"),
+		"http.delete": withoutBody("DELETE"),
+		"http.post":   withBody("POST"),
+		"http.put":    withBody("PUT"),
+		"http.patch":  withBody("PATCH"),
+		"http.request": func(ctx context.Context, opts interface{}) (*Object, error) {
+			o, err := objectArg("http.request", opts)
+			if err != nil {
+				return nil, err
+			}
+			req := modules.HttpRequest{Method: "GET"}
+			if v, ok := o.Get("method"); ok {
+				req.Method = strings.ToUpper(revealString(v))
+			}
+			if v, ok := o.Get("url"); ok {
+				req.URL = revealString(v)
+			}
+			if req.URL == "" {
+				return nil, fmt.Errorf("http.request: missing url")
+			}
+			if err := applyHttpOptions("http.request", &req, o); err != nil {
+				return nil, err
+			}
+			return doHttp(ctx, "http.request", req)
+		},
+	}
+}
+
+func doHttp(ctx context.Context, name string, req modules.HttpRequest) (*Object, error) {
+	client, err := httpClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	resp, err := modules.HttpDo(ctx, client, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return httpResponseObject(resp), nil
+}
+
+// httpClient returns the client for the run carried by ctx, built from
+// Options.HTTPTransport and Options.HTTPPolicy, and counts the request against
+// HTTPPolicy.MaxRequests.
+func httpClient(ctx context.Context) (*http.Client, error) {
+	state := stateFrom(ctx)
+	policy := state.opts.HTTPPolicy
+
+	if policy.MaxRequests > 0 && state.httpRequests >= policy.MaxRequests {
+		return nil, fmt.Errorf("request limit exceeded (%d requests)", policy.MaxRequests)
+	}
+	state.httpRequests++
+
+	if state.httpClient == nil {
+		transport := state.opts.HTTPTransport
+		if !policy.IsZero() {
+			var err error
+			if transport, err = modules.NewHttpPolicyTransport(transport, policy); err != nil {
+				return nil, err
+			}
+		}
+		state.httpClient = &http.Client{Transport: transport}
+	}
+	return state.httpClient, nil
+}
+
+// applyHttpOptions reads the request options shared by all http functions:
+// headers, query, json, form, body, timeout, follow_redirects and
+// max_redirects.
+func applyHttpOptions(name string, req *modules.HttpRequest, v interface{}) error {
+	o, err := objectArg(name, v)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := o.Get("headers"); ok && v != nil {
+		headers, err := objectArg(name+": headers", v)
+		if err != nil {
+			return err
+		}
+		for _, k := range headers.Keys() {
+			hv, _ := headers.Get(k)
+			req.Headers = append(req.Headers, [2]string{k, revealString(hv)})
+		}
+	}
+
+	if v, ok := o.Get("query"); ok && v != nil {
+		query, err := objectArg(name+": query", v)
+		if err != nil {
+			return err
+		}
+		req.Query = append(req.Query, formPairs(query)...)
+	}
+
+	for _, key := range []string{"json", "form", "body"} {
+		if v, ok := o.Get(key); ok && v != nil {
+			if err := setHttpBodyAs(name, req, key, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if v, ok := o.Get("timeout"); ok && v != nil {
+		d, err := toDuration(name, v)
+		if err != nil {
+			return err
+		}
+		req.Timeout = d
+	}
+	if v, ok := o.Get("max_redirects"); ok {
+		if n, isNumber := asNumber(v); isNumber {
+			req.MaxRedirects = int(n)
+		}
+	}
+	if v, ok := o.Get("follow_redirects"); ok && !ToBool(v) {
+		req.MaxRedirects = -1
+	}
+	return nil
+}
+
+// setHttpBody sets the positional body of post, put and patch: strings and
+// bytes are sent as they are, anything else as JSON.
+func setHttpBody(name string, req *modules.HttpRequest, v interface{}) error {
+	switch v.(type) {
+	case string, []byte, Secret:
+		return setHttpBodyAs(name, req, "body", v)
+	default:
+		return setHttpBodyAs(name, req, "json", v)
+	}
+}
+
+func setHttpBodyAs(name string, req *modules.HttpRequest, kind string, v interface{}) error {
+	switch kind {
+	case "json":
+		data, err := json.Marshal(revealValue(v))
+		if err != nil {
+			return fmt.Errorf("%s: encoding json body: %w", name, err)
+		}
+		req.Body, req.ContentType = data, "application/json"
+	case "form":
+		form, err := objectArg(name+": form", v)
+		if err != nil {
+			return err
+		}
+		var parts []string
+		for _, kv := range formPairs(form) {
+			parts = append(parts, url.QueryEscape(kv[0])+"="+url.QueryEscape(kv[1]))
+		}
+		req.Body, req.ContentType = []byte(strings.Join(parts, "&")), "application/x-www-form-urlencoded"
+	default:
+		if b, ok := v.([]byte); ok {
+			req.Body, req.ContentType = b, "application/octet-stream"
+			return nil
+		}
+		req.Body, req.ContentType = []byte(revealString(v)), "text/plain; charset=utf-8"
+	}
+	return nil
+}
+
+// formPairs flattens an object into key/value pairs in key order; array
+// values repeat the key.
+func formPairs(o *Object) [][2]string {
+	var pairs [][2]string
+	for _, k := range o.Keys() {
+		v, _ := o.Get(k)
+		if arr, ok := v.([]interface{}); ok {
+			for _, el := range arr {
+				pairs = append(pairs, [2]string{k, revealString(el)})
+			}
+			continue
+		}
+		pairs = append(pairs, [2]string{k, revealString(v)})
+	}
+	return pairs
+}
+
+// httpResponseObject converts a response to a script object. body holds the
+// decoded JSON for JSON responses and the text otherwise; text always holds
+// the raw body.
+func httpResponseObject(resp *modules.HttpResponse) *Object {
+	headers := NewObject()
+	contentType := ""
+	for _, kv := range resp.Headers {
+		headers.Set(kv[0], kv[1])
+		if kv[0] == "content-type" {
+			contentType = kv[1]
+		}
+	}
+
+	text := string(resp.Body)
+	var body interface{} = text
+	if strings.Contains(contentType, "json") {
+		if decoded, err := parseJSONOrdered(resp.Body); err == nil {
+			body = decoded
+		}
+	}
+
+	obj := NewObject()
+	obj.Set("status", float64(resp.Status))
+	obj.Set("status_text", resp.StatusText)
+	obj.Set("ok", resp.Status >= 200 && resp.Status < 300)
+	obj.Set("headers", headers)
+	obj.Set("body", body)
+	obj.Set("text", text)
+	obj.Set("url", resp.URL)
+	return obj
+}
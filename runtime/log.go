@@ -0,0 +1,70 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// LogFunctions send records to Options.LogHandler. log() logs at info level.
+func LogFunctions() Functions {
+	return Functions{
+		"log":       logAt("log", slog.LevelInfo),
+		"log.debug": logAt("log.debug", slog.LevelDebug),
+		"log.info":  logAt("log.info", slog.LevelInfo),
+		"log.warn":  logAt("log.warn", slog.LevelWarn),
+		"log.error": logAt("log.error", slog.LevelError),
+		"print": func(ctx context.Context, values ...interface{}) error {
+			parts := make([]string, len(values))
+			for i, v := range values {
+				parts[i] = formatOutput(v)
+			}
+			return emitLog(ctx, slog.LevelInfo, strings.Join(parts, " "), nil)
+		},
+	}
+}
+
+func logAt(name string, level slog.Level) func(ctx context.Context, msg interface{}, fields ...interface{}) error {
+	return func(ctx context.Context, msg interface{}, fields ...interface{}) error {
+		var attrs []slog.Attr
+		if len(fields) > 0 && fields[0] != nil {
+			o, err := objectArg(name, fields[0])
+			if err != nil {
+				return err
+			}
+			for _, k := range o.Keys() {
+				v, _ := o.Get(k)
+				attrs = append(attrs, slog.Any(k, v))
+			}
+		}
+		return emitLog(ctx, level, formatOutput(msg), attrs)
+	}
+}
+
+// emitLog sends a record to the run's log handler with the step, file and
+// line of the current call.
+func emitLog(ctx context.Context, level slog.Level, msg string, attrs []slog.Attr) error {
+	opts := OptionsFrom(ctx)
+	h := opts.LogHandler
+	if h == nil || !h.Enabled(ctx, level) {
+		return nil
+	}
+
+	state := stateFrom(ctx)
+	r := slog.NewRecord(opts.Now(), level, msg, 0)
+	r.AddAttrs(attrs...)
+	if state.step != "" {
+		r.AddAttrs(slog.String("step", state.step))
+	}
+	if opts.File != "" {
+		r.AddAttrs(slog.String("file", opts.File))
+	}
+	if state.line > 0 {
+		r.AddAttrs(slog.Int("line", state.line))
+	}
+	if err := h.Handle(ctx, r); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	return nil
+}
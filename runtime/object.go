@@ -0,0 +1,492 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Object is an insertion-ordered map. Object literals evaluate to *Object so
+// key order survives formatting and encoding.
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func NewObject() *Object {
+	return &Object{values: map[string]interface{}{}}
+}
+
+// ObjectFromMap wraps a Go map, ordering its keys alphabetically.
+func ObjectFromMap(m map[string]interface{}) *Object {
+	o := &Object{keys: sortedKeys(m), values: make(map[string]interface{}, len(m))}
+	for k, v := range m {
+		o.values[k] = v
+	}
+	return o
+}
+
+func (o *Object) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set stores value under key, appending the key if it is new.
+func (o *Object) Set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *Object) Delete(key string) {
+	if _, exists := o.values[key]; !exists {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys returns the keys in insertion order.
+func (o *Object) Keys() []string {
+	return append([]string{}, o.keys...)
+}
+
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Clone returns a shallow copy of o.
+func (o *Object) Clone() *Object {
+	c := &Object{keys: o.Keys(), values: make(map[string]interface{}, len(o.values))}
+	for k, v := range o.values {
+		c.values[k] = v
+	}
+	return c
+}
+
+// ToMap returns the entries as a plain Go map.
+func (o *Object) ToMap() map[string]interface{} {
+	m := make(map[string]interface{}, len(o.values))
+	for k, v := range o.values {
+		m[k] = v
+	}
+	return m
+}
+
+// plainObjects returns v with every object in it, however deeply nested,
+// replaced by a plain map, for values handed to Go code. Arrays and maps are
+// copied only if they contain an object; other values are returned as is.
+func plainObjects(v interface{}) interface{} {
+	if !containsObject(v) {
+		return v
+	}
+	switch val := v.(type) {
+	case *Object:
+		out := make(map[string]interface{}, val.Len())
+		for k, el := range val.values {
+			out[k] = plainObjects(el)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, el := range val {
+			out[i] = plainObjects(el)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, el := range val {
+			out[k] = plainObjects(el)
+		}
+		return out
+	case Context:
+		return Context(plainObjects(map[string]interface{}(val)).(map[string]interface{}))
+	}
+	return v
+}
+
+func containsObject(v interface{}) bool {
+	switch val := v.(type) {
+	case *Object:
+		return true
+	case []interface{}:
+		for _, el := range val {
+			if containsObject(el) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, el := range val {
+			if containsObject(el) {
+				return true
+			}
+		}
+	case Context:
+		return containsObject(map[string]interface{}(val))
+	}
+	return false
+}
+
+// String formats the object like a Go map, keeping insertion order.
+func (o *Object) String() string {
+	var out strings.Builder
+	out.WriteString("map[")
+	for i, k := range o.keys {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		fmt.Fprintf(&out, "%s:%v", k, o.values[k])
+	}
+	out.WriteString("]")
+	return out.String()
+}
+
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// parseJSONOrdered decodes JSON like encoding/json but returns objects as
+// *Object so their key order is kept.
+func parseJSONOrdered(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after value")
+	}
+	return v, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := NewObject()
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(keyTok.(string), val)
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			val, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		}
+		_, err := dec.Token()
+		return arr, err
+	default:
+		return tok, nil
+	}
+}
+
+// asObject returns v as an *Object; plain Go maps are copied into a new
+// object with sorted keys.
+func asObject(v interface{}) (*Object, bool) {
+	switch val := v.(type) {
+	case *Object:
+		return val, val != nil
+	case map[string]interface{}:
+		return ObjectFromMap(val), true
+	case Context:
+		return ObjectFromMap(val), true
+	case *Bound:
+		return val.fields()
+	default:
+		return nil, false
+	}
+}
+
+// keyString converts a value to an object key. Unlike formatOutput it keeps
+// the fraction of numbers, so 1.2 and 1.4 stay distinct keys.
+func keyString(v interface{}) string {
+	if n, ok := v.(float64); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return formatOutput(v)
+}
+
+// objectGet looks up key in an *Object or a plain map and converts the value
+// with toScriptValue.
+func objectGet(v interface{}, key string) (interface{}, bool, bool) {
+	switch val := v.(type) {
+	case *Object:
+		if val == nil {
+			return nil, false, false
+		}
+		got, found := val.Get(key)
+		return toScriptValue(got), found, true
+	case map[string]interface{}:
+		got, found := val[key]
+		return toScriptValue(got), found, true
+	case Context:
+		got, found := val[key]
+		return toScriptValue(got), found, true
+	case *Bound:
+		got, found := val.get(key)
+		return got, found, true
+	default:
+		return nil, false, false
+	}
+}
+
+// objectKeys returns the keys of an *Object in insertion order or of a plain
+// map in sorted order.
+func objectKeys(v interface{}) []string {
+	switch val := v.(type) {
+	case *Object:
+		return val.Keys()
+	case map[string]interface{}:
+		return sortedKeys(val)
+	case Context:
+		return sortedKeys(val)
+	case *Bound:
+		if obj, ok := val.fields(); ok {
+			return obj.Keys()
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+// pathSegment is one step of a path such as `a.b[0]["x-y"]`.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func parsePath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+	rest := path
+
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			rest = rest[1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path '%s': missing ']'", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			i, err := strconv.Atoi(inner)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid path '%s': bad index '%s'", path, inner)
+			}
+			segments = append(segments, pathSegment{index: i, isIndex: true})
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			segments = append(segments, pathSegment{key: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid path '%s'", path)
+	}
+	return segments, nil
+}
+
+func getPath(obj interface{}, segments []pathSegment) (interface{}, bool) {
+	cur := obj
+	for _, seg := range segments {
+		if seg.isIndex {
+			arr, ok := cur.([]interface{})
+			if !ok || seg.index >= len(arr) {
+				return nil, false
+			}
+			cur = arr[seg.index]
+			continue
+		}
+
+		val, found, _ := objectGet(cur, seg.key)
+		if !found {
+			return nil, false
+		}
+		cur = val
+	}
+	return cur, true
+}
+
+// setPath returns a copy of obj with value stored at segments. Objects and
+// arrays along the path are copied; missing ones are created. An index may
+// replace an element or append one, but not leave a gap.
+func setPath(obj interface{}, segments []pathSegment, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	seg := segments[0]
+
+	if seg.isIndex {
+		arr, ok := obj.([]interface{})
+		if !ok && obj != nil {
+			return nil, fmt.Errorf("cannot set index %d on %s", seg.index, typeName(obj))
+		}
+		if seg.index > len(arr) {
+			return nil, fmt.Errorf("cannot set index %d of an array of length %d", seg.index, len(arr))
+		}
+		res := make([]interface{}, max(len(arr), seg.index+1))
+		copy(res, arr)
+
+		child, err := setPath(res[seg.index], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		res[seg.index] = child
+		return res, nil
+	}
+
+	res := NewObject()
+	if obj != nil {
+		o, ok := asObject(obj)
+		if !ok {
+			return nil, fmt.Errorf("cannot set '%s' on %s", seg.key, typeName(obj))
+		}
+		res = o.Clone()
+	}
+
+	current, _ := res.Get(seg.key)
+	child, err := setPath(current, segments[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	res.Set(seg.key, child)
+	return res, nil
+}
+
+// deletePath returns a copy of obj without the value at segments. Missing
+// paths leave obj unchanged.
+func deletePath(obj interface{}, segments []pathSegment) interface{} {
+	seg := segments[0]
+
+	if seg.isIndex {
+		arr, ok := obj.([]interface{})
+		if !ok || seg.index >= len(arr) {
+			return obj
+		}
+		res := append([]interface{}{}, arr...)
+		if len(segments) == 1 {
+			return append(res[:seg.index], res[seg.index+1:]...)
+		}
+		res[seg.index] = deletePath(res[seg.index], segments[1:])
+		return res
+	}
+
+	if _, found, _ := objectGet(obj, seg.key); !found {
+		return obj
+	}
+	o, _ := asObject(obj)
+	res := o.Clone()
+	if len(segments) == 1 {
+		res.Delete(seg.key)
+		return res
+	}
+	child, _ := res.Get(seg.key)
+	res.Set(seg.key, deletePath(child, segments[1:]))
+	return res
+}
+
+// deepMerge recursively merges override into a copy of base. Nested objects
+// are merged; arrays follow strategy: "replace", "append", "unique" (append
+// without duplicates) or "merge" (merge element by element).
+func deepMerge(base, override *Object, strategy string) *Object {
+	res := base.Clone()
+	for _, k := range override.keys {
+		ov := override.values[k]
+		if bv, exists := res.Get(k); exists {
+			res.Set(k, mergeValues(bv, ov, strategy))
+		} else {
+			res.Set(k, ov)
+		}
+	}
+	return res
+}
+
+func mergeValues(base, override interface{}, strategy string) interface{} {
+	if bo, ok := asObject(base); ok {
+		if oo, ok := asObject(override); ok {
+			return deepMerge(bo, oo, strategy)
+		}
+	}
+
+	ba, bok := base.([]interface{})
+	oa, ook := override.([]interface{})
+	if !bok || !ook {
+		return override
+	}
+
+	switch strategy {
+	case "append":
+		return append(append([]interface{}{}, ba...), oa...)
+	case "unique":
+		all := append(append([]interface{}{}, ba...), oa...)
+		return uniqueBy(all, all)
+	case "merge":
+		res := append([]interface{}{}, ba...)
+		for i, v := range oa {
+			if i < len(res) {
+				res[i] = mergeValues(res[i], v, strategy)
+			} else {
+				res = append(res, v)
+			}
+		}
+		return res
+	default:
+		return override
+	}
+}
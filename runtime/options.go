@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"github.com/isaeken/brickengine-go/modules"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Options configures a single script or template run.
+type Options struct {
+	// Strict makes references to undefined variables and properties fail
+	// instead of resolving to nil. Pipe fallbacks, exists() and '?.' still
+	// allow intentional optional access.
+	Strict bool
+
+	// MaxOutputBytes caps the size of rendered template output. Zero uses
+	// the package-level MaxOutputBytes.
+	MaxOutputBytes int
+
+	// LeftDelim and RightDelim replace the "{{" and "}}" template
+	// delimiters, e.g. "[[" and "]]" when rendering Helm charts.
+	LeftDelim  string
+	RightDelim string
+
+	// Clock replaces time.Now for now(), time.now() and other built-ins
+	// that read the current time, e.g. to render with a fixed timestamp.
+	Clock func() time.Time
+
+	// Deterministic makes runs reproducible: random(), random_str() and
+	// uuid() draw from a generator seeded with Seed, and the clock is fixed
+	// at the Unix epoch unless Clock is set.
+	Deterministic bool
+	Seed          int64
+
+	// UUID replaces the generator behind uuid().
+	UUID func() string
+
+	// MaxSteps bounds the work of a run: every evaluated expression counts
+	// as one step and built-ins such as the regex functions charge steps in
+	// proportion to their input. Zero means no limit.
+	MaxSteps int
+
+	// HTTPTransport sends the requests of the http functions, e.g. a
+	// modules.HttpReplayer serving recorded responses in tests. Nil uses
+	// http.DefaultTransport.
+	HTTPTransport http.RoundTripper
+
+	// HTTPPolicy restricts the hosts the http functions may reach and the
+	// size and number of their requests.
+	HTTPPolicy modules.HttpPolicy
+
+	// FS is the file system of the fs functions, e.g. a modules.DirFS
+	// rooted at a deployment directory or a modules.MemFS in tests. Nil
+	// makes them fail.
+	FS modules.FileSystem
+
+	// Executor runs the commands of exec.run, e.g. modules.OSExecutor or a
+	// modules.DryRunExecutor. Nil makes exec.run fail.
+	Executor modules.Executor
+
+	// ExecPolicy lists the commands exec.run may run and caps their output.
+	ExecPolicy modules.ExecPolicy
+
+	// EnvAllow lists the environment variables env() may read. Entries
+	// ending in "*" match by prefix, e.g. "APP_*". Empty allows none.
+	EnvAllow []string
+
+	// LookupEnv replaces os.LookupEnv for env(), e.g. with a fixed
+	// environment in tests.
+	LookupEnv func(name string) (string, bool)
+
+	// Secrets serves secret(). Nil makes it fail.
+	Secrets modules.SecretProvider
+
+	// LogHandler receives the records of log() and print(), with the step,
+	// file and line of the call attached. Nil discards them.
+	LogHandler slog.Handler
+
+	// File names the script in log records.
+	File string
+}
+
+// Now returns the current time according to Clock.
+func (o Options) Now() time.Time {
+	if o.Clock != nil {
+		return o.Clock()
+	}
+	if o.Deterministic {
+		return time.Unix(0, 0).UTC()
+	}
+	return time.Now()
+}
+
+func (o Options) maxOutputBytes() int {
+	if o.MaxOutputBytes > 0 {
+		return o.MaxOutputBytes
+	}
+	return MaxOutputBytes
+}
+
+func resolveOptions(opts []Options) Options {
+	if len(opts) > 0 {
+		return opts[0]
+	}
+	return Options{}
+}
+
+func (o Options) delims() (string, string) {
+	left, right := o.LeftDelim, o.RightDelim
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+	return left, right
+}
@@ -0,0 +1,116 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+func RegexFunctions() Functions {
+	return Functions{
+		"re_match": func(ctx context.Context, s, pattern string) (bool, error) {
+			re, err := compileRegex(ctx, "re_match", pattern, s)
+			if err != nil {
+				return false, err
+			}
+			return re.MatchString(s), nil
+		},
+		"re_find": func(ctx context.Context, s, pattern string) (interface{}, error) {
+			re, err := compileRegex(ctx, "re_find", pattern, s)
+			if err != nil {
+				return nil, err
+			}
+			m := re.FindStringSubmatchIndex(s)
+			if m == nil {
+				return nil, nil
+			}
+			return regexMatch(re, s, m), nil
+		},
+		"re_find_all": func(ctx context.Context, s, pattern string) ([]interface{}, error) {
+			re, err := compileRegex(ctx, "re_find_all", pattern, s)
+			if err != nil {
+				return nil, err
+			}
+			matches := []interface{}{}
+			for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+				matches = append(matches, regexMatch(re, s, m))
+			}
+			return matches, nil
+		},
+		"re_replace": func(ctx context.Context, s, pattern, replacement string) (string, error) {
+			re, err := compileRegex(ctx, "re_replace", pattern, s)
+			if err != nil {
+				return "", err
+			}
+			return re.ReplaceAllString(s, replacement), nil
+		},
+		"re_split": func(ctx context.Context, s, pattern string, limit ...float64) ([]string, error) {
+			re, err := compileRegex(ctx, "re_split", pattern, s)
+			if err != nil {
+				return nil, err
+			}
+			n := -1
+			if len(limit) > 0 {
+				n = int(limit[0])
+			}
+			return re.Split(s, n), nil
+		},
+	}
+}
+
+// compileRegex returns the compiled pattern, cached for the rest of the run,
+// and charges the run's step limit for matching it against input.
+func compileRegex(ctx context.Context, name, pattern, input string) (*regexp.Regexp, error) {
+	state := stateFrom(ctx)
+	if err := state.charge(len(pattern) + len(input)); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if re, ok := state.regexps[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern: %w", name, err)
+	}
+	if state.regexps == nil {
+		state.regexps = map[string]*regexp.Regexp{}
+	}
+	state.regexps[pattern] = re
+	return re, nil
+}
+
+// regexMatch converts a submatch index slice to a script value: the matched
+// string when the pattern has no groups, an object of named groups when it has
+// any, and otherwise an array of the whole match followed by every group.
+// Groups that did not participate in the match are null.
+func regexMatch(re *regexp.Regexp, s string, m []int) interface{} {
+	group := func(i int) interface{} {
+		if m[2*i] < 0 {
+			return nil
+		}
+		return s[m[2*i]:m[2*i+1]]
+	}
+
+	if re.NumSubexp() == 0 {
+		return group(0)
+	}
+
+	names := re.SubexpNames()
+	if slices.ContainsFunc(names, func(name string) bool { return name != "" }) {
+		obj := NewObject()
+		for i, name := range names {
+			if name != "" {
+				obj.Set(name, group(i))
+			}
+		}
+		return obj
+	}
+
+	groups := make([]interface{}, len(names))
+	for i := range names {
+		groups[i] = group(i)
+	}
+	return groups
+}
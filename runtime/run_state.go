@@ -0,0 +1,101 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"math/rand"
+	"net/http"
+	"regexp"
+)
+
+// runState is the per-run state carried in the context passed to Go
+// functions.
+type runState struct {
+	opts    Options
+	rng     *rand.Rand
+	steps   int
+	regexps map[string]*regexp.Regexp
+	// funcs are the functions of the current call, used by render().
+	funcs Functions
+	// step and line locate the current call for log records.
+	step string
+	line int
+
+	httpClient   *http.Client
+	httpRequests int
+}
+
+func newRunContext(parent context.Context, opts Options) (context.Context, *runState) {
+	state := &runState{opts: opts}
+	return context.WithValue(parent, runStateKey{}, state), state
+}
+
+// charge counts n steps against Options.MaxSteps.
+func (s *runState) charge(n int) error {
+	if s.opts.MaxSteps <= 0 {
+		return nil
+	}
+	s.steps += n
+	if s.steps > s.opts.MaxSteps {
+		return fmt.Errorf("step limit exceeded (%d steps)", s.opts.MaxSteps)
+	}
+	return nil
+}
+
+type runStateKey struct{}
+
+// WithOptions returns a copy of ctx carrying opts and a fresh random source.
+// Go functions whose first parameter is a context.Context receive such a
+// context, so they can read the options of the current run with OptionsFrom.
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	ctx, _ = newRunContext(ctx, opts)
+	return ctx
+}
+
+func stateFrom(ctx context.Context) *runState {
+	if ctx != nil {
+		if state, ok := ctx.Value(runStateKey{}).(*runState); ok {
+			return state
+		}
+	}
+	return &runState{}
+}
+
+// OptionsFrom returns the options carried by ctx, or zero Options.
+func OptionsFrom(ctx context.Context) Options {
+	return stateFrom(ctx).opts
+}
+
+// RandFrom returns the random source of the run carried by ctx. It is seeded
+// with Options.Seed in deterministic mode. The source is not safe for
+// concurrent use.
+func RandFrom(ctx context.Context) *rand.Rand {
+	state := stateFrom(ctx)
+	if state.rng == nil {
+		seed := state.opts.Seed
+		if !state.opts.Deterministic {
+			seed = rand.Int63()
+		}
+		state.rng = rand.New(rand.NewSource(seed))
+	}
+	return state.rng
+}
+
+// NewUUID returns a version 4 UUID for the run carried by ctx, using
+// Options.UUID when set and the run's random source in deterministic mode.
+func NewUUID(ctx context.Context) string {
+	opts := OptionsFrom(ctx)
+	switch {
+	case opts.UUID != nil:
+		return opts.UUID()
+	case opts.Deterministic:
+		id, err := uuid.NewRandomFromReader(RandFrom(ctx))
+		if err != nil {
+			panic(err)
+		}
+		return id.String()
+	default:
+		return uuid.NewString()
+	}
+}
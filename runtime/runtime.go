@@ -1,39 +1,64 @@
 package runtime
 
 import (
+	"context"
 	"fmt"
 	"github.com/isaeken/brickengine-go/lexer"
 	"github.com/isaeken/brickengine-go/parser"
 )
 
-func RunTemplate(code string, ctx Context, funcs Functions) (string, error) {
-	return EvalTemplate(code, ctx, funcs)
+func RunTemplate(code string, ctx Context, funcs Functions, opts ...Options) (string, error) {
+	return EvalTemplate(code, ctx, funcs, opts...)
 }
 
-func RunScript(code string, ctx Context, funcs Functions) (string, error) {
+func RunScript(code string, ctx Context, funcs Functions, opts ...Options) (string, error) {
+	return RunScriptContext(context.Background(), code, ctx, funcs, opts...)
+}
+
+// RunScriptContext is RunScript with a context: canceling it stops the script
+// and the commands and requests it has in flight.
+func RunScriptContext(parent context.Context, code string, ctx Context, funcs Functions, opts ...Options) (string, error) {
+	val, err := EvalScriptContext(parent, code, ctx, funcs, opts...)
+	if err != nil {
+		return "", err
+	}
+	return formatOutput(val), nil
+}
+
+// EvalScript runs a script like RunScript but returns the value of its
+// return statement or last statement instead of formatting it, e.g. to read
+// it into a Go value with Decode.
+func EvalScript(code string, ctx Context, funcs Functions, opts ...Options) (interface{}, error) {
+	return EvalScriptContext(context.Background(), code, ctx, funcs, opts...)
+}
+
+// EvalScriptContext is EvalScript with a context, see RunScriptContext.
+func EvalScriptContext(parent context.Context, code string, ctx Context, funcs Functions, opts ...Options) (result interface{}, err error) {
+	defer recoverCycle(&err)
 	l := lexer.New(code)
 	p := parser.New(l)
 
 	statements, err := p.Parse()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
+	evaluator := NewEvaluatorContext(parent, resolveOptions(opts))
+	defer plainContext(ctx)
 	var last interface{} = ""
 
 	for _, stmt := range statements {
-		val, err := Evaluate(stmt, ctx, funcs)
+		val, err := evaluator.Evaluate(stmt, ctx, funcs)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		if IsReturn(val) {
-			ret := ExtractReturn(val)
-			return formatOutput(ret), nil
+			return ExtractReturn(val), nil
 		}
 		last = val
 	}
 
-	return formatOutput(last), nil
+	return last, nil
 }
 
 func formatOutput(output interface{}) string {
@@ -46,3 +71,11 @@ func formatOutput(output interface{}) string {
 		return fmt.Sprintf("%v", output)
 	}
 }
+
+// plainContext replaces the objects a script stored in ctx with plain maps,
+// so the host reads its variables back as map[string]interface{}.
+func plainContext(ctx Context) {
+	for k, v := range ctx {
+		ctx[k] = plainObjects(v)
+	}
+}
@@ -0,0 +1,140 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secret is a string that must not show up in output. It concatenates with
+// strings and renders in templates as its value, but prints as "***" in
+// script output, error messages, format() and the to_* emitters. Strings
+// concatenated with a secret become secrets themselves.
+type Secret struct {
+	value string
+}
+
+// NewSecret wraps value as a Secret.
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+func (s Secret) String() string   { return "***" }
+func (s Secret) GoString() string { return "***" }
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"***"`), nil
+}
+
+// revealString formats v like formatOutput, but with the value of secrets.
+// It is used for values leaving the script, such as request headers and
+// command arguments.
+func revealString(v interface{}) string {
+	if s, ok := v.(Secret); ok {
+		return s.value
+	}
+	return formatOutput(v)
+}
+
+// revealValue returns a copy of v with secrets in objects and arrays replaced
+// by their values, for encoding request bodies.
+func revealValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case Secret:
+		return val.value
+	case *Object:
+		out := NewObject()
+		for _, k := range val.Keys() {
+			el, _ := val.Get(k)
+			out.Set(k, revealValue(el))
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, el := range val {
+			out[k] = revealValue(el)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, el := range val {
+			out[i] = revealValue(el)
+		}
+		return out
+	}
+	return v
+}
+
+// EnvFunctions read environment variables allowed by Options.EnvAllow and
+// secrets from Options.Secrets.
+func EnvFunctions() Functions {
+	return Functions{
+		"env": func(ctx context.Context, name string, def ...interface{}) (interface{}, error) {
+			opts := OptionsFrom(ctx)
+			if !envAllowed(opts.EnvAllow, name) {
+				return nil, fmt.Errorf("env: variable '%s' is not allowed", name)
+			}
+			lookup := opts.LookupEnv
+			if lookup == nil {
+				lookup = os.LookupEnv
+			}
+			if value, ok := lookup(name); ok {
+				return value, nil
+			}
+			if len(def) > 0 {
+				return def[0], nil
+			}
+			return nil, nil
+		},
+		"secret": func(ctx context.Context, name string) (Secret, error) {
+			provider := OptionsFrom(ctx).Secrets
+			if provider == nil {
+				return Secret{}, fmt.Errorf("secret: no secret provider configured")
+			}
+			value, err := provider.Secret(ctx, name)
+			if err != nil {
+				return Secret{}, fmt.Errorf("secret '%s': %w", name, err)
+			}
+			return NewSecret(value), nil
+		},
+	}
+}
+
+// envAllowed reports whether name matches an entry of allow. Entries ending
+// in "*" match by prefix, e.g. "APP_*".
+func envAllowed(allow []string, name string) bool {
+	for _, entry := range allow {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if entry == name {
+			return true
+		}
+	}
+	return false
+}
+
+// concatSecret concatenates left and right as strings if either is a
+// secret, so the result stays redacted.
+func concatSecret(left, right interface{}) (Secret, bool) {
+	ls, lok := left.(Secret)
+	rs, rok := right.(Secret)
+	if !lok && !rok {
+		return Secret{}, false
+	}
+	l, r := ls.value, rs.value
+	if !lok {
+		l = fmt.Sprint(left)
+	}
+	if !rok {
+		r = fmt.Sprint(right)
+	}
+	return NewSecret(l + r), true
+}
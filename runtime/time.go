@@ -0,0 +1,216 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // time.in_zone must not depend on the host's zoneinfo
+)
+
+// Time is the script representation of a point in time. It prints as RFC 3339
+// and compares chronologically with the comparison operators.
+type Time struct {
+	time.Time
+}
+
+func (t Time) String() string {
+	return t.Format(time.RFC3339)
+}
+
+// timeLayouts are the layout names accepted by time.parse and time.format in
+// addition to Go reference layouts.
+var timeLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc822":      time.RFC822,
+	"date":        time.DateOnly,
+	"datetime":    time.DateTime,
+	"time":        time.TimeOnly,
+	"kitchen":     time.Kitchen,
+}
+
+func TimeFunctions() Functions {
+	return Functions{
+		"now": func(ctx context.Context) string {
+			return OptionsFrom(ctx).Now().UTC().Format(time.RFC3339)
+		},
+		"time.now": func(ctx context.Context) Time {
+			return Time{OptionsFrom(ctx).Now()}
+		},
+		"time.parse": func(s string, layout ...string) (Time, error) {
+			t, err := time.Parse(timeLayout(layout), s)
+			if err != nil {
+				return Time{}, fmt.Errorf("time.parse: %w", err)
+			}
+			return Time{t}, nil
+		},
+		"time.format": func(v interface{}, layout ...string) (string, error) {
+			t, err := toTime("time.format", v)
+			if err != nil {
+				return "", err
+			}
+			return t.Format(timeLayout(layout)), nil
+		},
+		"time.add": func(v interface{}, d interface{}) (Time, error) {
+			t, err := toTime("time.add", v)
+			if err != nil {
+				return Time{}, err
+			}
+			dur, err := toDuration("time.add", d)
+			if err != nil {
+				return Time{}, err
+			}
+			return Time{t.Add(dur)}, nil
+		},
+		"time.diff": func(a, b interface{}) (float64, error) {
+			ta, err := toTime("time.diff", a)
+			if err != nil {
+				return 0, err
+			}
+			tb, err := toTime("time.diff", b)
+			if err != nil {
+				return 0, err
+			}
+			return ta.Sub(tb.Time).Seconds(), nil
+		},
+		"time.unix": func(v interface{}) (float64, error) {
+			t, err := toTime("time.unix", v)
+			if err != nil {
+				return 0, err
+			}
+			return float64(t.Unix()), nil
+		},
+		"time.in_zone": func(v interface{}, zone string) (Time, error) {
+			t, err := toTime("time.in_zone", v)
+			if err != nil {
+				return Time{}, err
+			}
+			loc, err := time.LoadLocation(zone)
+			if err != nil {
+				return Time{}, fmt.Errorf("time.in_zone: unknown time zone '%s'", zone)
+			}
+			return Time{t.In(loc)}, nil
+		},
+		"time.start_of": func(v interface{}, unit string) (Time, error) {
+			t, err := toTime("time.start_of", v)
+			if err != nil {
+				return Time{}, err
+			}
+			return startOf(t, unit)
+		},
+	}
+}
+
+func timeLayout(layout []string) string {
+	if len(layout) == 0 || layout[0] == "" {
+		return time.RFC3339
+	}
+	if l, ok := timeLayouts[strings.ToLower(layout[0])]; ok {
+		return l
+	}
+	return layout[0]
+}
+
+// toTime converts a time value, an RFC 3339 string or a Unix timestamp in
+// seconds to a Time.
+func toTime(name string, v interface{}) (Time, error) {
+	switch val := v.(type) {
+	case Time:
+		return val, nil
+	case time.Time:
+		return Time{val}, nil
+	case string:
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return Time{}, fmt.Errorf("%s: invalid time '%s'", name, val)
+		}
+		return Time{t}, nil
+	}
+
+	if secs, ok := asNumber(v); ok {
+		return Time{time.Unix(0, int64(secs*float64(time.Second))).UTC()}, nil
+	}
+	return Time{}, fmt.Errorf("%s: expected time, got %s", name, typeName(v))
+}
+
+// toDuration converts a duration string or a number of seconds to a
+// time.Duration.
+func toDuration(name string, v interface{}) (time.Duration, error) {
+	if s, ok := v.(string); ok {
+		d, err := parseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		return d, nil
+	}
+	if secs, ok := asNumber(v); ok {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("%s: expected duration, got %s", name, typeName(v))
+}
+
+var dayUnitRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)([dw])`)
+
+// parseDuration parses a Go duration such as "72h" or "1h30m", additionally
+// accepting "d" (24h) and "w" (7d) units as in "1w2d".
+func parseDuration(s string) (time.Duration, error) {
+	expanded := dayUnitRegex.ReplaceAllStringFunc(s, func(m string) string {
+		parts := dayUnitRegex.FindStringSubmatch(m)
+		n, _ := strconv.ParseFloat(parts[1], 64)
+		if parts[2] == "w" {
+			n *= 7
+		}
+		return strconv.FormatFloat(n*24, 'f', -1, 64) + "h"
+	})
+
+	d, err := time.ParseDuration(strings.TrimSpace(expanded))
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+	return d, nil
+}
+
+// formatDuration formats d like time.Duration.String without trailing zero
+// units, e.g. "1h30m" instead of "1h30m0s".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// startOf truncates t to the start of unit in t's own location. Weeks start
+// on Monday.
+func startOf(t Time, unit string) (Time, error) {
+	y, m, d := t.Date()
+	loc := t.Location()
+
+	switch unit {
+	case "second":
+		return Time{t.Truncate(time.Second)}, nil
+	case "minute":
+		return Time{time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)}, nil
+	case "hour":
+		return Time{time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)}, nil
+	case "day":
+		return Time{time.Date(y, m, d, 0, 0, 0, 0, loc)}, nil
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return Time{time.Date(y, m, d-offset, 0, 0, 0, 0, loc)}, nil
+	case "month":
+		return Time{time.Date(y, m, 1, 0, 0, 0, 0, loc)}, nil
+	case "year":
+		return Time{time.Date(y, time.January, 1, 0, 0, 0, 0, loc)}, nil
+	default:
+		return Time{}, fmt.Errorf("time.start_of: unknown unit '%s'", unit)
+	}
+}
@@ -0,0 +1,187 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FileCreated   = "create"
+	FileUpdated   = "update"
+	FileUnchanged = "unchanged"
+)
+
+// RenderTreeOptions configures RenderTree.
+type RenderTreeOptions struct {
+	Functions Functions
+	// Options is applied to every rendered file and file name.
+	Options Options
+	// Patterns selects the files rendered as templates, matched with
+	// path.Match against the path relative to the source root and against
+	// the base name. Other files are copied verbatim. Empty renders every
+	// file.
+	Patterns []string
+	// DryRun computes the result and a diff against the destination
+	// without writing anything.
+	DryRun bool
+}
+
+// RenderedFile describes one file produced by RenderTree.
+type RenderedFile struct {
+	Source   string
+	Path     string
+	Action   string
+	Rendered bool
+	// Diff is a unified diff against the existing destination file, set
+	// in dry-run mode for rendered files.
+	Diff string
+}
+
+// RenderTree walks src and writes every file into dst, rendering files that
+// match the configured patterns. File and directory names are templates too,
+// so "{{ vars.name }}.conf" is written under the rendered name. Permissions of
+// the source files are preserved.
+func RenderTree(src fs.FS, dst string, ctx Context, opts RenderTreeOptions) ([]RenderedFile, error) {
+	var files []RenderedFile
+
+	err := fs.WalkDir(src, ".", func(srcPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if srcPath == "." {
+			return nil
+		}
+
+		relPath, err := renderPath(srcPath, ctx, opts)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(relPath))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if opts.DryRun {
+				return nil
+			}
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		}
+
+		content, err := fs.ReadFile(src, srcPath)
+		if err != nil {
+			return err
+		}
+
+		file := RenderedFile{Source: srcPath, Path: relPath}
+		if matchesPatterns(srcPath, opts.Patterns) {
+			file.Rendered = true
+			fileOpts := opts
+			if fileOpts.Options.File == "" {
+				fileOpts.Options.File = srcPath
+			}
+			if content, err = renderFile(content, ctx, fileOpts); err != nil {
+				return fmt.Errorf("%s: %w", srcPath, err)
+			}
+		}
+
+		existing, err := os.ReadFile(target)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			file.Action = FileCreated
+		case err != nil:
+			return err
+		case bytes.Equal(existing, content):
+			file.Action = FileUnchanged
+		default:
+			file.Action = FileUpdated
+		}
+
+		if opts.DryRun {
+			if file.Rendered {
+				file.Diff = unifiedDiff(relPath, string(existing), string(content))
+			}
+			files = append(files, file)
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+			return err
+		}
+
+		files = append(files, file)
+		return nil
+	})
+
+	return files, err
+}
+
+// renderPath renders every segment of a slash-separated source path and
+// rejects results that would escape the destination.
+func renderPath(srcPath string, ctx Context, opts RenderTreeOptions) (string, error) {
+	left, _ := opts.Options.delims()
+	if !strings.Contains(srcPath, left) {
+		return srcPath, nil
+	}
+
+	segments := strings.Split(srcPath, "/")
+	for i, seg := range segments {
+		if !strings.Contains(seg, left) {
+			continue
+		}
+		name, err := EvalTemplate(seg, ctx, opts.Functions, opts.Options)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", srcPath, err)
+		}
+		segments[i] = name
+	}
+
+	rendered := strings.Join(segments, "/")
+	if !filepath.IsLocal(filepath.FromSlash(rendered)) {
+		return "", fmt.Errorf("%s: rendered path '%s' is not inside the destination", srcPath, rendered)
+	}
+	return rendered, nil
+}
+
+func renderFile(content []byte, ctx Context, opts RenderTreeOptions) ([]byte, error) {
+	t, err := ParseTemplate(string(content), opts.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, ctx, opts.Functions); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func matchesPatterns(srcPath string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, srcPath); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(srcPath)); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -1,34 +1,143 @@
 package runtime
 
 import (
+	"cmp"
 	"fmt"
+	"github.com/isaeken/brickengine-go/parser"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type ReturnedValue struct {
 	Value interface{}
 }
 
+// UndefinedError is returned in strict mode when a variable or property
+// does not exist.
+type UndefinedError struct {
+	Path       string
+	Suggestion string
+}
+
+func (e *UndefinedError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("undefined variable '%s' (did you mean '%s'?)", e.Path, e.Suggestion)
+	}
+	return fmt.Sprintf("undefined variable '%s'", e.Path)
+}
+
 func ResolveVariable(ctx Context, parts []string) (interface{}, error) {
+	return resolveVariable(ctx, &parser.VariableExpr{Parts: parts}, false)
+}
+
+func resolveVariable(ctx Context, v *parser.VariableExpr, strict bool) (interface{}, error) {
 	var val interface{} = map[string]interface{}(ctx)
-	for _, p := range parts {
-		if m, ok := val.(map[string]interface{}); ok {
-			val = m[p]
-		} else {
+	for i, p := range v.Parts {
+		optional := v.IsOptional(i)
+		if val == nil && optional {
+			return nil, nil
+		}
+
+		next, found, isObject := objectGet(val, p)
+		if !isObject {
 			return nil, fmt.Errorf("cannot access '%s' in non-object (%T)", p, val)
 		}
+
+		if !found {
+			if optional {
+				return nil, nil
+			}
+			if strict {
+				return nil, newUndefinedError(v.Parts[:i+1], objectKeys(val))
+			}
+		}
+		val = next
 	}
 	return val, nil
 }
 
+// lookupVariable resolves parts without failing and reports whether every
+// segment of the path exists.
+func lookupVariable(ctx Context, parts []string) (interface{}, bool) {
+	var val interface{} = map[string]interface{}(ctx)
+	for _, p := range parts {
+		next, found, _ := objectGet(val, p)
+		if !found {
+			return nil, false
+		}
+		val = next
+	}
+	return val, true
+}
+
+func newUndefinedError(path []string, scope []string) *UndefinedError {
+	err := &UndefinedError{Path: strings.Join(path, ".")}
+
+	name := path[len(path)-1]
+	if key := nearestKey(name, scope); key != "" {
+		suggestion := append(append([]string{}, path[:len(path)-1]...), key)
+		err.Suggestion = strings.Join(suggestion, ".")
+	}
+
+	return err
+}
+
+// nearestKey returns the key of scope closest to name by edit distance, or an
+// empty string when nothing is similar enough to be a likely typo.
+func nearestKey(name string, scope []string) string {
+	best := ""
+	bestDist := len([]rune(name))/2 + 1
+	for _, k := range scope {
+		if d := levenshtein(name, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
 func EvalBinary(left interface{}, right interface{}, op string) (interface{}, error) {
 	lf, lok := ToFloat(left)
 	rf, rok := ToFloat(right)
 
+	if IsComparisonOperator(op) && (!lok || !rok) {
+		return compareNonNumeric(left, right, op)
+	}
+
 	if IsComparisonOperator(op) {
-		if !lok || !rok {
-			return nil, fmt.Errorf("comparison operations require numeric operands")
-		}
 		switch op {
 		case "==":
 			return lf == rf, nil
@@ -46,6 +155,9 @@ func EvalBinary(left interface{}, right interface{}, op string) (interface{}, er
 	}
 
 	if op == "+" {
+		if secret, ok := concatSecret(left, right); ok {
+			return secret, nil
+		}
 		if ls, ok := left.(string); ok {
 			rs := fmt.Sprint(right)
 			return ls + rs, nil
@@ -77,6 +189,42 @@ func EvalBinary(left interface{}, right interface{}, op string) (interface{}, er
 	}
 }
 
+// compareNonNumeric compares operands that are not both numbers. Equality
+// works on any values; ordering requires two strings, two booleans or two
+// times.
+func compareNonNumeric(left, right interface{}, op string) (interface{}, error) {
+	switch op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	}
+
+	rank := typeRank(left)
+	if rank != typeRank(right) || (rank != 1 && rank != 3 && rank != 4) {
+		return nil, fmt.Errorf("comparison operations require numeric operands")
+	}
+
+	c := compareValues(left, right)
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if typeRank(a) < 5 && typeRank(b) < 5 {
+		return compareValues(a, b) == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
 func ToFloat(v interface{}) (float64, bool) {
 	switch val := v.(type) {
 	case int:
@@ -91,6 +239,69 @@ func ToFloat(v interface{}) (float64, bool) {
 	}
 }
 
+// asNumber converts any Go numeric value to float64 without parsing strings.
+func asNumber(v interface{}) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(v)
+	if !isNumberKind(rv.Kind()) {
+		return 0, false
+	}
+	return rv.Convert(reflect.TypeOf(float64(0))).Float(), true
+}
+
+// compareValues orders two values. Numbers, strings, booleans and times
+// compare naturally; values of different types are ordered null < boolean <
+// number < string < time < anything else.
+func compareValues(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return cmp.Compare(ra, rb)
+	}
+
+	switch ra {
+	case 1:
+		ab, bb := a.(bool), b.(bool)
+		if ab == bb {
+			return 0
+		}
+		if !ab {
+			return -1
+		}
+		return 1
+	case 2:
+		af, _ := asNumber(a)
+		bf, _ := asNumber(b)
+		return cmp.Compare(af, bf)
+	case 3:
+		return strings.Compare(a.(string), b.(string))
+	case 4:
+		ta, _ := toTime("compare", a)
+		tb, _ := toTime("compare", b)
+		return ta.Compare(tb.Time)
+	default:
+		return 0
+	}
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return 3
+	case Time, time.Time:
+		return 4
+	}
+	if _, ok := asNumber(v); ok {
+		return 2
+	}
+	return 5
+}
+
 func ToBool(v interface{}) bool {
 	if b, ok := v.(bool); ok {
 		return b
@@ -128,6 +339,8 @@ func IsTruthy(val interface{}) bool {
 		return v != 0
 	case int:
 		return v != 0
+	case Secret:
+		return v.value != ""
 	default:
 		return true
 	}
@@ -0,0 +1,98 @@
+package units
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// sizeUnits maps lower-case unit names to their size in bytes. Decimal units
+// use powers of 1000 (KB, MB, ...) and binary units powers of 1024 (KiB, MiB,
+// ...). Single letters are decimal, as in Kubernetes quantities.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"p":   1e15,
+	"pb":  1e15,
+	"ki":  1 << 10,
+	"kib": 1 << 10,
+	"mi":  1 << 20,
+	"mib": 1 << 20,
+	"gi":  1 << 30,
+	"gib": 1 << 30,
+	"ti":  1 << 40,
+	"tib": 1 << 40,
+	"pi":  1 << 50,
+	"pib": 1 << 50,
+}
+
+// binarySizeUnits are the units FormatSize picks from when no unit is given.
+var binarySizeUnits = []string{"PiB", "TiB", "GiB", "MiB", "KiB"}
+
+// ParseSize parses a size such as "512MB", "1.5G" or "2 GiB" into bytes.
+// Units are case-insensitive.
+func ParseSize(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, unicode.IsLetter)
+	if i < 0 {
+		i = len(s)
+	}
+
+	num, err := strconv.ParseFloat(strings.TrimSpace(s[:i]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	factor, err := sizeUnit(s[i:])
+	if err != nil {
+		return 0, err
+	}
+	return num * factor, nil
+}
+
+// ConvertSize returns bytes expressed in unit, e.g. ConvertSize(1<<30, "MiB")
+// is 1024.
+func ConvertSize(bytes float64, unit string) (float64, error) {
+	factor, err := sizeUnit(unit)
+	if err != nil {
+		return 0, err
+	}
+	return bytes / factor, nil
+}
+
+// FormatSize formats bytes in unit, or in the largest binary unit that keeps
+// the value at least 1 when unit is empty. Values are rounded to two decimals.
+func FormatSize(bytes float64, unit string) (string, error) {
+	if unit == "" {
+		unit = "B"
+		for _, u := range binarySizeUnits {
+			if math.Abs(bytes) >= sizeUnits[strings.ToLower(u)] {
+				unit = u
+				break
+			}
+		}
+	}
+
+	value, err := ConvertSize(bytes, unit)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64) + unit, nil
+}
+
+func sizeUnit(unit string) (float64, error) {
+	factor, ok := sizeUnits[strings.ToLower(strings.TrimSpace(unit))]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit '%s'", unit)
+	}
+	return factor, nil
+}